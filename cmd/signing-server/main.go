@@ -0,0 +1,37 @@
+// Command signing-server runs the reference signing service of signertest,
+// holding the funder key apart from stellar-create-pool
+package main
+
+import (
+  "os"
+  "log"
+  "flag"
+  "net/http"
+  "github.com/stellar/go/keypair"
+  "github.com/matheusb-comp/stellar-create-pool/signertest"
+)
+
+// Environment variables with the secret seed of the key and the token
+const SECRET_ENV = "SIGNER_SECRET"
+const TOKEN_ENV = "SIGNER_TOKEN"
+
+func main() {
+  addr := flag.String("addr", "127.0.0.1:8001", "Address to listen on")
+  flag.Parse()
+
+  kp, err := keypair.Parse(os.Getenv(SECRET_ENV))
+  if err != nil {
+    log.Fatal("Error: set the secret seed in ", SECRET_ENV, ": ", err)
+  }
+  full, ok := kp.(*keypair.Full)
+  if !ok {
+    log.Fatal("Error: ", SECRET_ENV, " must be a secret seed")
+  }
+  token := os.Getenv(TOKEN_ENV)
+  if token == "" {
+    log.Println("Warning: no", TOKEN_ENV, "set, anyone that connects can sign")
+  }
+
+  log.Println("Signing for", full.Address(), "on", *addr)
+  log.Fatal(http.ListenAndServe(*addr, &signertest.Handler{KP: full, Token: token}))
+}
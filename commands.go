@@ -0,0 +1,272 @@
+package main
+
+import (
+  "os"
+  "fmt"
+  "flag"
+  "sort"
+  "errors"
+  "context"
+  "encoding/json"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
+)
+
+// Each subcommand runs one phase, reading and writing the accounts file.
+// Without a subcommand, "run" does every phase like older versions
+var commands = map[string]func(ctx context.Context) error{
+  "run": runCmd,
+  "generate": generateCmd,
+  "regenerate": regenerateCmd,
+  "fund": fundCmd,
+  "set-inflation": setInflationCmd,
+  "verify": verifyCmd,
+  "status": statusCmd,
+  "dissolve": dissolveCmd,
+  "migrate": migrateCmd,
+}
+
+// Commands that submit transactions, and write a report of them
+var submits = map[string]bool{
+  "run": true,
+  "fund": true,
+  "set-inflation": true,
+  "dissolve": true,
+  "migrate": true,
+}
+
+func usage() {
+  out := flag.CommandLine.Output()
+  fmt.Fprintln(out, "Usage:", os.Args[0], "[command] [flags]")
+  fmt.Fprintln(out, "\nCommands (without one, every phase is run):")
+  fmt.Fprintln(out, "  generate       Generate -num keypairs into the -accounts file")
+  fmt.Fprintln(out, "  regenerate     Derive -num keypairs from the mnemonic into the -accounts file")
+  fmt.Fprintln(out, "  fund           Fund the accounts of the -accounts file that still need it")
+  fmt.Fprintln(out, "  set-inflation  Set the inflation destination of the funded accounts")
+  fmt.Fprintln(out, "  verify         Check the accounts' inflation destination on the network")
+  fmt.Fprintln(out, "  status         Count the accounts of the -accounts file by status")
+  fmt.Fprintln(out, "  dissolve       Merge the funded accounts of the -accounts file into -dest")
+  fmt.Fprintln(out, "  migrate        Move the accounts voting for -from to the -inflation destination")
+  fmt.Fprintln(out, "\nFlags:")
+  flag.PrintDefaults()
+}
+
+// Generate, fund and set the inflation destination in one go
+// (main already opened the journal in cfg.Journal)
+func runCmd(ctx context.Context) error {
+  res, err := pool.Run(ctx, cfg)
+  if res != nil {
+    fmt.Println("Generated:", len(res.Generated))
+    fmt.Println("Funded:", len(res.Funded))
+    fmt.Println("Inflation set:", len(res.Inflated))
+  }
+  return err
+}
+
+func generateCmd(ctx context.Context) error {
+  // Never replace a file that may have the only copy of funded secret seeds
+  if _, err := os.Stat(accountsFile + ".json"); err == nil {
+    return errors.New(accountsFile + ".json already exists")
+  }
+  journal := pool.NewJournal()
+  pairs, err := pool.GenerateVoters(ctx, cfg, journal)
+  if err != nil { return err }
+  fmt.Println("Generated:", len(pairs))
+  return pool.SaveVoters(accountsFile, journal.Voters(), cfg.Passphrase)
+}
+
+// Recreates the key file of accounts derived from the mnemonic, starting at
+// -index. Their state is unknown, so they are written without a status
+// (taken as funded), and verify tells which ones exist
+func regenerateCmd(ctx context.Context) error {
+  if _, err := os.Stat(accountsFile + ".json"); err == nil {
+    return errors.New(accountsFile + ".json already exists")
+  }
+  pairs, err := pool.Derive(cfg.Mnemonic, cfg.MnemonicPassword, cfg.FirstIndex, cfg.NumAccounts)
+  if err != nil { return err }
+  voters := make([]pool.VoterJSON, len(pairs))
+  for i, p := range pairs {
+    index := cfg.FirstIndex + i
+    voters[i] = pool.VoterJSON{Pub: p.Address(), Sec: p.Seed(), Index: &index}
+  }
+  fmt.Println("Regenerated:", len(voters))
+  return pool.SaveVoters(accountsFile, voters, cfg.Passphrase)
+}
+
+func fundCmd(ctx context.Context) error {
+  journal, err := pool.OpenAccounts(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+  cfg.Journal = journal
+  toFund, _, _ := journal.Pending()
+
+  funded, err := pool.Fund(ctx, cfg, cfg.Client(), toFund)
+  fmt.Println("Funded:", len(funded), "of", len(toFund))
+  return saveAccounts(journal, err)
+}
+
+func setInflationCmd(ctx context.Context) error {
+  journal, err := pool.OpenAccounts(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+  cfg.Journal = journal
+  _, toSet, _ := journal.Pending()
+
+  set, err := pool.SetInflation(ctx, cfg, cfg.Client(), toSet)
+  fmt.Println("Inflation set:", len(set), "of", len(toSet))
+  return saveAccounts(journal, err)
+}
+
+// Merges every account of the pool, recording the merged ones in the
+// accounts file
+func dissolveCmd(ctx context.Context) error {
+  journal, err := pool.OpenAccounts(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+  cfg.Journal = journal
+  toMerge := journal.Existing()
+
+  report, err := pool.Dissolve(ctx, cfg, cfg.Client(), toMerge)
+  if report != nil {
+    if jsonOutput {
+      printJSON(report)
+    } else {
+      for _, m := range report.Merged {
+        fmt.Println(m.Pub, "merged with", m.Balance, "XLM")
+      }
+      fmt.Println("Merged:", len(report.Merged), "of", report.Total, "into", report.Dest)
+      fmt.Println("Recovered:", report.Recovered, "XLM (before fees)")
+      if len(report.Failed) > 0 {
+        codes := make(map[string]int)
+        for _, c := range report.Failed {
+          codes[c]++
+        }
+        fmt.Println("Failures:")
+        printCounts(codes, "  ")
+      }
+    }
+  }
+  return saveAccounts(journal, err)
+}
+
+// Re-points the accounts voting for -from, recording the ones migrated in
+// the accounts file
+func migrateCmd(ctx context.Context) error {
+  journal, err := pool.OpenAccounts(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+  cfg.Journal = journal
+
+  report, err := pool.Migrate(ctx, cfg, cfg.Client(), journal.Existing())
+  if report != nil {
+    if jsonOutput {
+      printJSON(report)
+    } else {
+      for _, a := range report.Accounts {
+        switch {
+        case a.Migrated:
+          fmt.Println(a.Pub, "migrated from", a.Before, "to", a.After)
+        case a.Code != pool.MIGRATE_OTHER_DEST:
+          fmt.Println(a.Pub, "not migrated:", a.Code)
+        }
+      }
+      fmt.Println("Migrated:", report.Migrated, "of", report.Total, "from", report.From, "to", report.To)
+      fmt.Println("Voting for other destinations:", report.Skipped)
+      fmt.Println("Failed:", report.Failed)
+    }
+  }
+  return saveAccounts(journal, err)
+}
+
+// Writes the results back to the accounts file (except on dry runs),
+// even if the phase stopped with err
+func saveAccounts(journal *pool.Journal, err error) error {
+  cfg.Report.Finish(journal, err)
+  if cfg.DryRun != nil { return err }
+  saveErr := pool.SaveVoters(accountsFile, journal.Voters(), cfg.Passphrase)
+  if err != nil { return err }
+  return saveErr
+}
+
+func verifyCmd(ctx context.Context) error {
+  voters, err := pool.ReadVoters(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+  addresses := make([]string, len(voters))
+  for i, v := range voters {
+    addresses[i] = v.Pub
+  }
+
+  report, err := pool.Verify(ctx, cfg, cfg.Client(), addresses)
+  if err != nil { return err }
+  if jsonOutput {
+    err = printJSON(report)
+  } else {
+    for _, c := range report.Accounts {
+      switch {
+      case c.OK:
+        continue
+      case c.Error != "":
+        fmt.Println(c.Pub, "error:", c.Error)
+      case !c.Exists:
+        fmt.Println(c.Pub, "does not exist")
+      default:
+        fmt.Println(c.Pub, "inflation destination is", c.InflationDest, "- balance:", c.Balance)
+      }
+    }
+    fmt.Println("Verified:", report.OK, "of", report.Total)
+    fmt.Println("Missing:", report.Missing)
+    fmt.Println("Wrong inflation destination:", report.WrongInflation)
+    fmt.Println("Errors:", report.Errors)
+  }
+  if err == nil && report.OK < report.Total {
+    err = errors.New(fmt.Sprint(report.Total - report.OK, " accounts failed verification"))
+  }
+  return err
+}
+
+func statusCmd(ctx context.Context) error {
+  voters, err := pool.ReadVoters(accountsFile, cfg.Passphrase)
+  if err != nil { return err }
+
+  // Count the accounts by status, and the failures by phase and code
+  states := make(map[string]int)
+  codes := make(map[string]int)
+  for _, v := range voters {
+    status := v.Status
+    if status == "" {
+      status = "(no status)"
+    }
+    states[status]++
+    if v.Status == pool.STATE_FAILED {
+      codes[v.FailedPhase + " " + v.Code]++
+    }
+  }
+  if jsonOutput {
+    return printJSON(map[string]interface{}{
+      "total": len(voters),
+      "statuses": states,
+      "failures": codes,
+    })
+  }
+  fmt.Println("Accounts:", len(voters))
+  printCounts(states, "  ")
+  if len(codes) > 0 {
+    fmt.Println("Failures:")
+    printCounts(codes, "  ")
+  }
+  return nil
+}
+
+// Prints the counts sorted by key
+func printCounts(counts map[string]int, indent string) {
+  var keys []string
+  for k := range counts {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  for _, k := range keys {
+    fmt.Println(indent + k + ":", counts[k])
+  }
+}
+
+// Prints v as indented JSON to the standard output
+func printJSON(v interface{}) error {
+  enc := json.NewEncoder(os.Stdout)
+  enc.SetIndent("", " ")
+  return enc.Encode(v)
+}
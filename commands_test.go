@@ -0,0 +1,55 @@
+package main
+
+import (
+  "os"
+  "testing"
+  "context"
+  "io/ioutil"
+  "path/filepath"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/keypair"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
+  "github.com/matheusb-comp/stellar-create-pool/horizontest"
+)
+
+func TestVerifyCmd(t *testing.T) {
+  srv := horizontest.NewServer(build.TestNetwork)
+  defer srv.Close()
+  funder, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  srv.AddAccount(funder.Address(), 10000000000)
+  dir, err := ioutil.TempDir("", "pool")
+  if err != nil { t.Fatal(err) }
+  defer os.RemoveAll(dir)
+
+  saved, savedFile := cfg, accountsFile
+  defer func() { cfg, accountsFile = saved, savedFile }()
+  accountsFile = filepath.Join(dir, "accounts")
+  cfg = pool.Config{
+    Horizon: pool.HorizonClient{srv.Client()},
+    FunderPub: funder.Address(),
+    FunderSec: funder.Seed(),
+    NumAccounts: 3,
+    NumOps: 10,
+    MinBalance: 40000000,
+    MaxBalance: 60000000,
+    OutputFile: accountsFile,
+  }
+  _, err = pool.Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  err = verifyCmd(context.Background())
+  if err != nil { t.Fatal(err) }
+
+  // One account that doesn't exist makes it fail
+  voters, err := pool.ReadVoters(accountsFile, "")
+  if err != nil { t.Fatal(err) }
+  missing, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  voters = append(voters, pool.VoterJSON{Pub: missing.Address(), Sec: missing.Seed()})
+  err = pool.SaveVoters(accountsFile, voters, "")
+  if err != nil { t.Fatal(err) }
+  err = verifyCmd(context.Background())
+  if err == nil || err.Error() != "1 accounts failed verification" {
+    t.Errorf("got error %v, expected 1 account failing", err)
+  }
+}
@@ -0,0 +1,203 @@
+package horizontest
+
+import (
+  "sort"
+  "time"
+  "strconv"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/amount"
+  "github.com/stellar/go/keypair"
+)
+
+// Applies the transaction to the accounts (s.mu must be held), returning the
+// transaction and operation result codes. Like stellar-core, the fee and the
+// sequence are consumed even if the operations fail, but nothing else changes
+func (s *Server) apply(env *xdr.TransactionEnvelope, hash [32]byte) (string, []string) {
+  tx := env.Tx
+  src, ok := s.accounts[tx.SourceAccount.Address()]
+  if !ok { return "tx_no_account", nil }
+
+  // Check the transaction itself
+  if tb := tx.TimeBounds; tb != nil {
+    now := uint64(time.Now().Unix())
+    if tb.MinTime != 0 && now < uint64(tb.MinTime) { return "tx_too_early", nil }
+    if tb.MaxTime != 0 && now > uint64(tb.MaxTime) { return "tx_too_late", nil }
+  }
+  if len(tx.Operations) == 0 { return "tx_missing_operation", nil }
+  if int64(tx.Fee) < s.minFee * int64(len(tx.Operations)) { return "tx_insufficient_fee", nil }
+  if int64(tx.SeqNum) != src.Sequence + 1 { return "tx_bad_seq", nil }
+  if weight(env, hash, src) < 1 { return "tx_bad_auth", nil }
+  // Like stellar-core, the signatures of every operation are checked before
+  // charging anything. Sources that don't exist yet (created by an earlier
+  // operation) need their master key
+  for _, op := range tx.Operations {
+    opSrc := src
+    if op.SourceAccount != nil {
+      address := op.SourceAccount.Address()
+      if a, ok := s.accounts[address]; ok {
+        opSrc = a
+      } else {
+        opSrc = Account{Address: address}
+      }
+    }
+    if weight(env, hash, opSrc) < threshold(opSrc) { return "tx_bad_auth", nil }
+  }
+  if src.Balance - int64(tx.Fee) < minBalance(src) { return "tx_insufficient_balance", nil }
+
+  // Consume the fee and the sequence number
+  src.Balance -= int64(tx.Fee)
+  src.Sequence = int64(tx.SeqNum)
+  s.accounts[src.Address] = src
+
+  // Apply the operations to a copy of the accounts, keeping it only if all succeed
+  state := make(map[string]Account, len(s.accounts))
+  for k, v := range s.accounts {
+    state[k] = v
+  }
+  codes := make([]string, len(tx.Operations))
+  failed := false
+  for i, op := range tx.Operations {
+    opSrc := src.Address
+    if op.SourceAccount != nil {
+      opSrc = op.SourceAccount.Address()
+    }
+    codes[i] = s.applyOp(state, opSrc, op.Body)
+    if codes[i] != "op_success" {
+      failed = true
+    }
+  }
+  if failed { return "tx_failed", codes }
+
+  s.accounts = state
+  return "tx_success", codes
+}
+
+// Applies one operation to the state, returning its result code
+func (s *Server) applyOp(state map[string]Account, source string, body xdr.OperationBody) string {
+  src, ok := state[source]
+  if !ok { return "op_no_source_account" }
+
+  switch body.Type {
+  case xdr.OperationTypeCreateAccount:
+    op := body.MustCreateAccountOp()
+    dest := op.Destination.Address()
+    if _, exists := state[dest]; exists { return "op_already_exists" }
+    if int64(op.StartingBalance) < 2 * BASE_RESERVE { return "op_low_reserve" }
+    if src.Balance - int64(op.StartingBalance) < minBalance(src) { return "op_underfunded" }
+    src.Balance -= int64(op.StartingBalance)
+    state[source] = src
+    state[dest] = s.newAccount(dest, int64(op.StartingBalance))
+
+  case xdr.OperationTypeSetOptions:
+    op := body.MustSetOptionsOp()
+    if op.InflationDest != nil {
+      dest := op.InflationDest.Address()
+      if _, exists := state[dest]; !exists { return "op_invalid_inflation" }
+      src.InflationDest = dest
+      state[source] = src
+    }
+
+  case xdr.OperationTypeAccountMerge:
+    merge := body.MustDestination()
+    dest := merge.Address()
+    if dest == source { return "op_malformed" }
+    d, exists := state[dest]
+    if !exists { return "op_no_account" }
+    d.Balance += src.Balance
+    state[dest] = d
+    delete(state, source)
+
+  default:
+    return "op_not_supported"
+  }
+  return "op_success"
+}
+
+// Minimum balance of an account without subentries (2 base reserves)
+func minBalance(a Account) int64 {
+  return 2 * BASE_RESERVE
+}
+
+// Weight of the signatures of the account's keys in the envelope
+func weight(env *xdr.TransactionEnvelope, hash [32]byte, a Account) int32 {
+  var w int32
+  if signedBy(env, hash, a.Address) {
+    w++
+  }
+  for address, signer := range a.Signers {
+    if signedBy(env, hash, address) {
+      w += signer
+    }
+  }
+  return w
+}
+
+// Weight needed by the operations of the account
+func threshold(a Account) int32 {
+  if a.MedThreshold < 1 { return 1 }
+  return a.MedThreshold
+}
+
+// Checks if the envelope has a valid signature from the address' master key
+func signedBy(env *xdr.TransactionEnvelope, hash [32]byte, address string) bool {
+  kp, err := keypair.Parse(address)
+  if err != nil { return false }
+  for _, sig := range env.Signatures {
+    if [4]byte(sig.Hint) != kp.Hint() { continue }
+    if kp.Verify(hash[:], []byte(sig.Signature)) == nil {
+      return true
+    }
+  }
+  return false
+}
+
+// JSON of the account, as returned by Horizon's /accounts endpoint
+func accountJSON(a Account) map[string]interface{} {
+  return map[string]interface{}{
+    "id": a.Address,
+    "account_id": a.Address,
+    "sequence": strconv.FormatInt(a.Sequence, 10),
+    "subentry_count": 0,
+    "inflation_destination": a.InflationDest,
+    "thresholds": map[string]int32{
+      "low_threshold": 0,
+      "med_threshold": a.MedThreshold,
+      "high_threshold": a.MedThreshold,
+    },
+    "flags": map[string]bool{
+      "auth_required": false,
+      "auth_revocable": false,
+    },
+    "balances": []map[string]string{
+      {
+        "balance": amount.String(xdr.Int64(a.Balance)),
+        "asset_type": "native",
+      },
+    },
+    "signers": signersJSON(a),
+    "data": map[string]string{},
+  }
+}
+
+// Signers of the account, the master key first and the others sorted
+func signersJSON(a Account) []map[string]interface{} {
+  var others []string
+  for address := range a.Signers {
+    others = append(others, address)
+  }
+  sort.Strings(others)
+  var signers []map[string]interface{}
+  for _, address := range append([]string{a.Address}, others...) {
+    w := int32(1)
+    if address != a.Address {
+      w = a.Signers[address]
+    }
+    signers = append(signers, map[string]interface{}{
+      "public_key": address,
+      "key": address,
+      "weight": w,
+      "type": "ed25519_public_key",
+    })
+  }
+  return signers
+}
@@ -0,0 +1,272 @@
+// Package horizontest runs an in-process fake Horizon server. It decodes the
+// submitted transaction envelopes and applies them to accounts kept in memory,
+// answering with the same JSON (and result codes) as a real Horizon would
+package horizontest
+
+import (
+  "sync"
+  "strconv"
+  "strings"
+  "net/http"
+  "encoding/hex"
+  "encoding/json"
+  "net/http/httptest"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/network"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Values of the network, in stroops
+const BASE_FEE = 100
+const BASE_RESERVE = 5000000
+const FRIENDBOT_AMOUNT = 100000000000
+
+// Account as stored by the fake server
+type Account struct {
+  Address string
+  Sequence int64
+  Balance int64
+  InflationDest string
+  // Weight of each signer besides the master key (weight 1), by address
+  Signers map[string]int32
+  // Weight needed by the operations (at least 1)
+  MedThreshold int32
+}
+
+type Server struct {
+  // URL of the server, to be used as the Horizon URL
+  URL string
+  Network build.Network
+  srv *httptest.Server
+  mu sync.Mutex
+  ledger int32
+  // Smallest fee per operation accepted
+  minFee int64
+  accounts map[string]Account
+  // Transactions in the ledger (including the ones whose operations
+  // failed), by hash
+  transactions map[string]map[string]interface{}
+}
+
+// NewServer starts a fake Horizon for the network, without any accounts.
+// The server must be closed with Close when done
+func NewServer(network build.Network) *Server {
+  s := &Server{
+    Network: network,
+    ledger: 1,
+    minFee: BASE_FEE,
+    accounts: make(map[string]Account),
+    transactions: make(map[string]map[string]interface{}),
+  }
+  s.srv = httptest.NewServer(s)
+  s.URL = s.srv.URL
+  return s
+}
+
+func (s *Server) Close() {
+  s.srv.Close()
+}
+
+// Client returns a Horizon client connected to the server
+func (s *Server) Client() *horizon.Client {
+  return &horizon.Client{URL: s.URL, HTTP: http.DefaultClient}
+}
+
+// FriendbotURL returns the URL of the server's friendbot, that must be
+// followed by the address to fund
+func (s *Server) FriendbotURL() string {
+  return s.URL + "/friendbot?addr="
+}
+
+// AddAccount creates (or replaces) the account with a balance in stroops
+func (s *Server) AddAccount(address string, balance int64) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.accounts[address] = s.newAccount(address, balance)
+}
+
+// SetSigners adds signers to the account, by address with their weights,
+// and sets its medium threshold, like a multisig account. Returns false if
+// the account doesn't exist
+func (s *Server) SetSigners(address string, signers map[string]int32, medThreshold int32) bool {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  a, ok := s.accounts[address]
+  if !ok { return false }
+  a.Signers = make(map[string]int32)
+  for k, w := range signers {
+    a.Signers[k] = w
+  }
+  a.MedThreshold = medThreshold
+  s.accounts[address] = a
+  return true
+}
+
+// SetMinFee changes the smallest fee per operation accepted (in stroops),
+// to act like a congested network
+func (s *Server) SetMinFee(fee int64) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.minFee = fee
+}
+
+// Account returns a copy of the account, and false if it doesn't exist
+func (s *Server) Account(address string) (Account, bool) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  a, ok := s.accounts[address]
+  return a, ok
+}
+
+// Accounts return the number of accounts that exist in the server
+func (s *Server) Accounts() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return len(s.accounts)
+}
+
+// The sequence of new accounts start at the current ledger, like stellar-core
+func (s *Server) newAccount(address string, balance int64) Account {
+  return Account{
+    Address: address,
+    Sequence: int64(s.ledger) << 32,
+    Balance: balance,
+  }
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  switch {
+  case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/accounts/"):
+    s.getAccount(w, strings.TrimPrefix(r.URL.Path, "/accounts/"))
+  case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/transactions/"):
+    s.getTransaction(w, strings.TrimPrefix(r.URL.Path, "/transactions/"))
+  case r.Method == "POST" && r.URL.Path == "/transactions":
+    s.postTransaction(w, r)
+  case r.Method == "GET" && r.URL.Path == "/fee_stats":
+    s.feeStats(w)
+  case r.URL.Path == "/friendbot":
+    s.friendbot(w, r.URL.Query().Get("addr"))
+  default:
+    writeProblem(w, http.StatusNotFound, "not_found", "Resource Missing", nil)
+  }
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, address string) {
+  a, ok := s.Account(address)
+  if !ok {
+    writeProblem(w, http.StatusNotFound, "not_found", "Resource Missing", nil)
+    return
+  }
+  writeJSON(w, http.StatusOK, accountJSON(a))
+}
+
+// Every transaction pays the smallest fee, so all the stats are the same
+func (s *Server) feeStats(w http.ResponseWriter) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  fee := strconv.FormatInt(s.minFee, 10)
+  stats := map[string]string{
+    "last_ledger": strconv.Itoa(int(s.ledger)),
+    "last_ledger_base_fee": strconv.Itoa(BASE_FEE),
+    "ledger_capacity_usage": "0.5",
+    "min_accepted_fee": fee,
+    "mode_accepted_fee": fee,
+  }
+  for _, p := range []string{"10", "20", "30", "40", "50", "60", "70", "80", "90", "95", "99"} {
+    stats["p" + p + "_accepted_fee"] = fee
+  }
+  writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) friendbot(w http.ResponseWriter, address string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if _, exists := s.accounts[address]; exists || address == "" {
+    writeProblem(w, http.StatusBadRequest, "transaction_failed", "Transaction Failed", map[string]interface{}{
+      "result_codes": horizon.TransactionResultCodes{
+        TransactionCode: "tx_failed",
+        OperationCodes: []string{"op_already_exists"},
+      },
+    })
+    return
+  }
+  s.ledger++
+  s.accounts[address] = s.newAccount(address, FRIENDBOT_AMOUNT)
+  writeJSON(w, http.StatusOK, map[string]interface{}{
+    "hash": hex.EncodeToString([]byte(address)),
+    "ledger": s.ledger,
+  })
+}
+
+func (s *Server) postTransaction(w http.ResponseWriter, r *http.Request) {
+  txb64 := r.FormValue("tx")
+  var env xdr.TransactionEnvelope
+  err := xdr.SafeUnmarshalBase64(txb64, &env)
+  if err != nil {
+    writeProblem(w, http.StatusBadRequest, "transaction_malformed", "Transaction Malformed", map[string]interface{}{
+      "envelope_xdr": txb64,
+    })
+    return
+  }
+  hash, err := network.HashTransaction(&env.Tx, s.Network.Passphrase)
+  if err != nil {
+    writeProblem(w, http.StatusInternalServerError, "server_error", "Internal Server Error", nil)
+    return
+  }
+
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  txCode, opCodes := s.apply(&env, hash)
+  // Like Horizon, transactions whose operations failed are also listed
+  if txCode == "tx_success" || txCode == "tx_failed" {
+    s.ledger++
+    s.transactions[hex.EncodeToString(hash[:])] = map[string]interface{}{
+      "hash": hex.EncodeToString(hash[:]),
+      "ledger": s.ledger,
+      "envelope_xdr": txb64,
+      "successful": txCode == "tx_success",
+    }
+  }
+  if txCode != "tx_success" {
+    writeProblem(w, http.StatusBadRequest, "transaction_failed", "Transaction Failed", map[string]interface{}{
+      "envelope_xdr": txb64,
+      "result_codes": horizon.TransactionResultCodes{
+        TransactionCode: txCode,
+        OperationCodes: opCodes,
+      },
+    })
+    return
+  }
+  writeJSON(w, http.StatusOK, s.transactions[hex.EncodeToString(hash[:])])
+}
+
+func (s *Server) getTransaction(w http.ResponseWriter, hash string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  tx, ok := s.transactions[hash]
+  if !ok {
+    writeProblem(w, http.StatusNotFound, "not_found", "Resource Missing", nil)
+    return
+  }
+  writeJSON(w, http.StatusOK, tx)
+}
+
+// Writes a JSON response with the status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+  w.Header().Set("Content-Type", "application/hal+json; charset=utf-8")
+  w.WriteHeader(status)
+  json.NewEncoder(w).Encode(v)
+}
+
+// Writes a problem response, like the errors returned by Horizon
+func writeProblem(w http.ResponseWriter, status int, kind string, title string, extras map[string]interface{}) {
+  w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+  w.WriteHeader(status)
+  json.NewEncoder(w).Encode(map[string]interface{}{
+    "type": "https://stellar.org/horizon-errors/" + kind,
+    "title": title,
+    "status": status,
+    "extras": extras,
+  })
+}
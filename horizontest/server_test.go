@@ -0,0 +1,96 @@
+package horizontest
+
+import (
+  "testing"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/keypair"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Submits a transaction from src setting the inflation destination of
+// opSrc, signed by the seeds. Returns the transaction result code
+func submitSetOptions(t *testing.T, s *Server, src string, opSrc string, seeds ...string) string {
+  a, _ := s.Account(src)
+  tx, err := build.Transaction(
+    build.SourceAccount{AddressOrSeed: src},
+    build.Sequence{Sequence: uint64(a.Sequence) + 1},
+    s.Network,
+    build.SetOptions(build.SourceAccount{AddressOrSeed: opSrc}, build.InflationDest(src)),
+  )
+  if err != nil { t.Fatal(err) }
+  txe, err := tx.Sign(seeds...)
+  if err != nil { t.Fatal(err) }
+  txb64, err := txe.Base64()
+  if err != nil { t.Fatal(err) }
+
+  _, err = s.Client().SubmitTransaction(txb64)
+  if err == nil { return "tx_success" }
+  herr, ok := err.(*horizon.Error)
+  if !ok { t.Fatal(err) }
+  codes, err := herr.ResultCodes()
+  if err != nil { t.Fatal(err) }
+  return codes.TransactionCode
+}
+
+// Creates n random accounts with 100 XLM
+func testAccounts(t *testing.T, s *Server, n int) []*keypair.Full {
+  var pairs []*keypair.Full
+  for i := 0; i < n; i++ {
+    p, err := keypair.Random()
+    if err != nil { t.Fatal(err) }
+    s.AddAccount(p.Address(), 1000000000)
+    pairs = append(pairs, p)
+  }
+  return pairs
+}
+
+func TestBadAuthChargesNothing(t *testing.T) {
+  s := NewServer(build.TestNetwork)
+  defer s.Close()
+  pairs := testAccounts(t, s, 2)
+  src, other := pairs[0], pairs[1]
+  before, _ := s.Account(src.Address())
+
+  // The source of the operation didn't sign
+  code := submitSetOptions(t, s, src.Address(), other.Address(), src.Seed())
+  if code != "tx_bad_auth" {
+    t.Fatalf("got %s, expected tx_bad_auth", code)
+  }
+  after, _ := s.Account(src.Address())
+  if after.Balance != before.Balance || after.Sequence != before.Sequence {
+    t.Errorf("charged the fee or the sequence of a transaction with bad auth")
+  }
+
+  code = submitSetOptions(t, s, src.Address(), other.Address(), src.Seed(), other.Seed())
+  if code != "tx_success" {
+    t.Fatalf("got %s, expected tx_success", code)
+  }
+}
+
+func TestSigners(t *testing.T) {
+  s := NewServer(build.TestNetwork)
+  defer s.Close()
+  pairs := testAccounts(t, s, 2)
+  src, cosigner := pairs[0], pairs[1]
+  if !s.SetSigners(src.Address(), map[string]int32{cosigner.Address(): 1}, 2) {
+    t.Fatal("the account doesn't exist")
+  }
+
+  // The master key alone doesn't reach the medium threshold
+  code := submitSetOptions(t, s, src.Address(), src.Address(), src.Seed())
+  if code != "tx_bad_auth" {
+    t.Fatalf("got %s, expected tx_bad_auth", code)
+  }
+  code = submitSetOptions(t, s, src.Address(), src.Address(), src.Seed(), cosigner.Seed())
+  if code != "tx_success" {
+    t.Fatalf("got %s, expected tx_success", code)
+  }
+
+  // Horizon lists the signers and the threshold
+  acc, err := s.Client().LoadAccount(src.Address())
+  if err != nil { t.Fatal(err) }
+  if len(acc.Signers) != 2 || acc.Thresholds.MedThreshold != 2 {
+    t.Errorf("loaded %d signers and medium threshold %d, expected 2 and 2",
+      len(acc.Signers), acc.Thresholds.MedThreshold)
+  }
+}
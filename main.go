@@ -5,665 +5,435 @@ import (
   "fmt"
   "log"
   "flag"
-  "sync"
   "time"
-  "math"
+  "errors"
+  "regexp"
+  "context"
   "strconv"
-  "net/http"
-  "math/rand"
-  "io/ioutil"
-  "encoding/json"
-  "github.com/stellar/go/build"
-  "github.com/stellar/go/keypair"
+  "strings"
+  "golang.org/x/crypto/ssh/terminal"
   "github.com/stellar/go/clients/horizon"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
 )
 
-const WG_MAX = 25
-const OPS_PER_TX_MAX = 100
-const SIGNERS_PER_TX_MAX = 20
-const TIMEOUT_WAIT_SECONDS = 5
-const TESTNET_FRIENDBOT_URL = "https://friendbot.stellar.org/?addr="
-
-type Voters []*keypair.Full
-
-type TransactionCreator interface {
-  // Builds a transaction with sequence seq and returns the base64 encoded XDR
-  CreateTransaction(seq uint64, dest []*keypair.Full) (string, bool)
-}
-type AccountFunder struct {
-  Min int
-  Max int
-  Pub string
-  Sec string
-  Seq uint64
-}
-type InflationSetter struct {
-  C *horizon.Client
-  InfDest string
-}
-
-type VoterJSON struct{
-  Pub string `json:"pub"`
-  Sec string `json:"sec"`
-}
-// type VotersJSON struct {
-//   Pool   string      `json:"pool"`
-//   Voters []VoterJSON `json:"voters"`
-// }
-
-
-var horizonURL, funderPub, funderSec, infDest, inputFile, outputFile string
-var livenet, useSink, onlyGenerate bool
-// TODO: minBal and maxBal should be uint64
-var numAccounts, numOps, minBal, maxBal int
+var cfg pool.Config
+var dryRunFile, journalFile, accountsFile, reportFile string
+var encrypt, jsonOutput, mnemonic bool
+var secretFile, signerURL string
+var feePayerSecFile string
+var cosigners, cosignerFiles listFlag
+var askSecret, insecureSecret bool
+var vanityMatch string
+var distName, amountsFile string
+var mean, stdDev int64
+var configName, profileName string
+
+// Environment variable with the passphrase of encrypted account files
+const PASSPHRASE_ENV = "STELLAR_POOL_PASSPHRASE"
+// Environment variable with the token of the -signer service
+const SIGNER_TOKEN_ENV = "STELLAR_POOL_SIGNER_TOKEN"
+// Environment variables with the mnemonic the accounts are derived from,
+// and its optional password
+const MNEMONIC_ENV = "STELLAR_POOL_MNEMONIC"
+const MNEMONIC_PASSWORD_ENV = "STELLAR_POOL_MNEMONIC_PASSWORD"
 
 func init() {
-  // Seed the pseudo-random generator
-  rand.Seed(time.Now().UnixNano())
+  flag.Usage = usage
   // Set the flags default values and usage strings
-  flag.StringVar(&horizonURL, "horizon", "",
+  flag.StringVar(&cfg.HorizonURL, "horizon", "",
     "URL of the Horizon server (default \"" +
       horizon.DefaultTestNetClient.URL +
       "\" for testnet and \"" +
       horizon.DefaultPublicNetClient.URL +
       "\" for livenet)",
   )
-  flag.StringVar(&funderPub, "src",
+  flag.StringVar(&configName, "config", CONFIG_FILE,
+    "TOML file with the network profiles, ignored if the default doesn't exist",
+  )
+  flag.StringVar(&profileName, "profile", "",
+    "Name of the profile of the config file to use (default: its \"profile\" setting)",
+  )
+  flag.StringVar(&cfg.NetworkPassphrase, "network", "",
+    "Passphrase of the network, to use a network other than testnet and livenet",
+  )
+  flag.StringVar(&cfg.FriendbotURL, "friendbot", pool.TESTNET_FRIENDBOT_URL,
+    "URL used to ask the friendbot for funds, followed by the address",
+  )
+  flag.StringVar(&cfg.FunderPub, "src",
     "GCFXD4OBX4TZ5GGBWIXLIJHTU2Z6OWVPYYU44QSKCCU7P2RGFOOHTEST",
     "Source address that will fund the accounts",
   )
-  flag.StringVar(&funderSec, "sec", "",
-    "Secret seed of the address being used to fund the accounts",
+  flag.StringVar(&cfg.FunderSec, "sec", "",
+    "Secret seed of the address being used to fund the accounts " +
+      "(saved in the shell history, prefer the other ways to give it)",
+  )
+  flag.StringVar(&secretFile, "secFile", "",
+    "File with the secret seed of the funder, only accessible by its owner",
+  )
+  flag.BoolVar(&askSecret, "askSec", false,
+    "Ask the secret seed of the funder in the terminal",
+  )
+  flag.BoolVar(&insecureSecret, "insecureSec", false,
+    "Allow -sec on livenet",
+  )
+  flag.StringVar(&signerURL, "signer", "",
+    "URL of a signing service holding the funder key, used instead of its " +
+      "secret seed (with the token in " + SIGNER_TOKEN_ENV + ")",
+  )
+  flag.Var(&cosigners, "cosigner",
+    "Another signer of a multisig funder, as <address>=<signing service URL> " +
+      "(can be repeated)",
+  )
+  flag.Var(&cosignerFiles, "cosignerFile",
+    "File with the secret seed of another signer of a multisig funder, " +
+      "only accessible by its owner (can be repeated)",
+  )
+  flag.StringVar(&cfg.InflationDest, "inflation", "",
+    "Address to set as the inflation destination in the accounts (default: -src)",
+  )
+  flag.StringVar(&cfg.MigrateFrom, "from", "",
+    "Inflation destination of the accounts moved to -inflation by the migrate command",
   )
-  flag.StringVar(&infDest, "inflation", funderPub,
-    "Address to set as the inflation destination in the accounts",
+  flag.StringVar(&cfg.MergeDest, "dest", "",
+    "Address the accounts are merged into by the dissolve command (default: -src)",
   )
-  flag.StringVar(&inputFile, "input", "accounts",
+  flag.StringVar(&cfg.InputFile, "input", "accounts",
     "Name of a JSON file with funded accounts to set the inflation. Format: " +
       "[ {\"pub\": <address:string>, \"sec\": <secret_seed:string>}, ... ]",
   )
-  flag.StringVar(&outputFile, "output", "new_accounts",
-    "Name of a JSON file to store the new accounts created, " +
-      "truncating it if it already exists",
+  flag.StringVar(&cfg.OutputFile, "output", "new_accounts",
+    "Name of a JSON file to store the new accounts created (an earlier " +
+      "run's is only replaced with -overwrite or -resume, never on dry runs)",
   )
-  flag.IntVar(&numAccounts, "num", 10,
+  flag.IntVar(&cfg.NumAccounts, "num", 10,
     "Number of accounts to create and fund",
   )
-  flag.IntVar(&numOps, "ops", 100,
+  flag.BoolVar(&mnemonic, "mnemonic", false,
+    "Derive the accounts from a mnemonic (SEP-0005), read from " + MNEMONIC_ENV +
+      " or asked in the terminal, instead of generating random keypairs",
+  )
+  flag.IntVar(&cfg.FirstIndex, "index", 0,
+    "Derivation index of the first account, when using -mnemonic",
+  )
+  flag.StringVar(&cfg.Vanity.Prefix, "prefix", "",
+    "Only generate addresses starting with this (including the leading G)",
+  )
+  flag.StringVar(&cfg.Vanity.Suffix, "suffix", "",
+    "Only generate addresses ending with this",
+  )
+  flag.StringVar(&vanityMatch, "match", "",
+    "Only generate addresses matching this regular expression",
+  )
+  flag.IntVar(&cfg.NumOps, "ops", 100,
     "Number of operations to send in each transaction (max: " +
-      strconv.Itoa(OPS_PER_TX_MAX) + ")",
+      strconv.Itoa(pool.OPS_PER_TX_MAX) + ")",
   )
-  flag.IntVar(&minBal, "min", 40000000,
+  flag.Int64Var(&cfg.MinBalance, "min", 40000000,
     "Min value for the account random initial funding (in stroops)",
   )
-  flag.IntVar(&maxBal, "max", 60000000,
+  flag.Int64Var(&cfg.MaxBalance, "max", 60000000,
     "Max value for the account random initial funding (in stroops)",
   )
-  flag.BoolVar(&livenet, "live", false,
+  flag.StringVar(&distName, "dist", "uniform",
+    "Distribution of the initial funding: fixed, uniform, normal, lognormal or csv",
+  )
+  flag.Int64Var(&mean, "amount", 50000000,
+    "Initial funding of the fixed distribution, and mean of the normal " +
+      "and lognormal ones (in stroops)",
+  )
+  flag.Int64Var(&stdDev, "stddev", 10000000,
+    "Standard deviation of the normal and lognormal distributions (in stroops)",
+  )
+  flag.StringVar(&amountsFile, "amounts", "amounts.csv",
+    "CSV file with the initial funding (in XLM) of the csv distribution, " +
+      "with \"address,amount\" or \"amount\" rows",
+  )
+  flag.Int64Var(&cfg.TotalBalance, "total", 0,
+    "Spread exactly this much across the accounts funded, in the " +
+      "proportions of -dist (in stroops, 0 to disable)",
+  )
+  flag.IntVar(&cfg.Channels, "channels", 0,
+    "Number of channel accounts used to fund in parallel (max: " +
+      strconv.Itoa(pool.OPS_PER_TX_MAX) + ", 0 funds one batch at a time)",
+  )
+  flag.StringVar(&cfg.ChannelsFile, "channelsFile", "channels",
+    "Name of a JSON file to store the channel accounts while they exist",
+  )
+  flag.BoolVar(&cfg.Combined, "combined", false,
+    "Set the inflation destination in the same transactions that fund the accounts",
+  )
+  flag.StringVar(&cfg.FeePayer, "feePayer", "",
+    "Address that pays the fees of the inflation transactions, or funder " +
+      "(default: the first account of each transaction)",
+  )
+  flag.StringVar(&feePayerSecFile, "feePayerSecFile", "",
+    "File with the secret seed of -feePayer (or in " + FEE_PAYER_SECRET_ENV + "), " +
+      "only accessible by its owner",
+  )
+  flag.Uint64Var(&cfg.BaseFee, "fee", pool.BASE_FEE_MIN,
+    "Fee of each operation (in stroops)",
+  )
+  flag.Uint64Var(&cfg.MaxFee, "maxFee", 10 * pool.BASE_FEE_MIN,
+    "Highest fee of each operation, when raising it after tx_insufficient_fee " +
+      "(in stroops, 0 to never raise it)",
+  )
+  flag.StringVar(&cfg.FeeStats, "feeStats", "",
+    "Pay the fee in this field of Horizon's fee stats (like mode or p90), if higher than -fee",
+  )
+  flag.DurationVar(&cfg.TxTimeout, "timeout", 5 * time.Minute,
+    "Time after which each transaction expires, if it didn't land (0 for never)",
+  )
+  flag.StringVar(&cfg.MemoType, "memoType", pool.MEMO_TEXT,
+    "Type of the memos: text, id, hash or none",
+  )
+  flag.StringVar(&cfg.FundMemo, "fundMemo", pool.FUND_MEMO,
+    "Memo template of the funding transactions, with {batch}, {run}, {pool} and {dest}",
+  )
+  flag.StringVar(&cfg.InflationMemo, "inflationMemo", pool.INFLATION_MEMO,
+    "Memo template of the transactions that set the inflation destination",
+  )
+  flag.StringVar(&cfg.MergeMemo, "mergeMemo", pool.MERGE_MEMO,
+    "Memo template of the transactions that merge accounts",
+  )
+  flag.StringVar(&cfg.RunID, "runID", "",
+    "ID of the run in the memos (default: the Unix time when it starts)",
+  )
+  flag.StringVar(&cfg.PoolName, "pool", "",
+    "Name of the pool in the memos",
+  )
+  flag.BoolVar(&cfg.Livenet, "live", false,
     "Create and fund the accounts on Stellar's livenet",
   )
-  flag.BoolVar(&useSink, "sink", false,
+  flag.BoolVar(&cfg.UseSink, "sink", false,
     "Use Stellar's friendbot as the funder, if working on testnet",
   )
-  flag.BoolVar(&onlyGenerate, "onlyGenerate", false,
+  flag.BoolVar(&cfg.OnlyGenerate, "onlyGenerate", false,
     "Only generate new account keypairs, don't fund or set inflation",
   )
-}
-
-func validateFlags() {
-  if numAccounts < 0 { numAccounts = 0 }
-  if numOps < 1 { numOps = 1 }
-  if numOps > OPS_PER_TX_MAX { numOps = OPS_PER_TX_MAX }
-  if minBal < 10000000 { minBal = 10000000 }
-  if maxBal < 10000001 { maxBal = 10000001 }
-  if minBal == maxBal { maxBal = minBal + 1 }
-  if maxBal < minBal {
-    tmp := minBal
-    minBal = maxBal
-    maxBal = tmp
-  }
-  if funderSec != "" && (funderSec[0] != 'S' || len(funderSec) < 56) {
-    log.Fatal("Error: Invalid secret key")
-  }
-  if funderSec == "" && !useSink && !onlyGenerate {
-    log.Fatal("Error: Provide a secret key or " +
-      "set a flag like 'sink' or 'onlyGenerate'")
-  }
+  flag.BoolVar(&encrypt, "encrypt", false,
+    "Encrypt the output and journal with a passphrase, read from " +
+      PASSPHRASE_ENV + " or asked in the terminal",
+  )
+  flag.StringVar(&journalFile, "journal", "journal",
+    "Name of a JSON lines file to record the state of every account " +
+      "(an earlier run's is never replaced, unless with -overwrite)",
+  )
+  flag.BoolVar(&cfg.Overwrite, "overwrite", false,
+    "Replace the -journal and -output files of an earlier run, losing the secret seeds in them",
+  )
+  flag.BoolVar(&cfg.Resume, "resume", false,
+    "Resume the run recorded in the journal, instead of generating new accounts",
+  )
+  flag.StringVar(&accountsFile, "accounts", "new_accounts",
+    "Name of the JSON file with the accounts read and written by the " +
+      "subcommands (generate, fund, set-inflation, verify, status)",
+  )
+  flag.StringVar(&reportFile, "report", "report",
+    "Name of a JSON file to write the transactions and the final state " +
+      "of the accounts to, at the end of the run",
+  )
+  flag.BoolVar(&jsonOutput, "json", false,
+    "Print the results of the verify, status, dissolve and migrate commands as JSON",
+  )
+  flag.StringVar(&dryRunFile, "dryRun", "",
+    "Name of a JSON file to write the signed transactions to, " +
+      "instead of submitting them",
+  )
 }
 
 func main() {
-  var wg sync.WaitGroup
-  var client *horizon.Client
+  // The first argument may be a subcommand, otherwise run the whole pipeline
+  name, args := "run", os.Args[1:]
+  if len(args) > 0 {
+    if _, ok := commands[args[0]]; ok {
+      name, args = args[0], args[1:]
+    }
+  }
 
   // Parse and validate the command line arguments
-  flag.Parse()
-  validateFlags()
-
-  // Set the Horizon client and URL
-  if livenet {
-    client = horizon.DefaultPublicNetClient
-  } else {
-    client = horizon.DefaultTestNetClient
+  flag.CommandLine.Parse(args)
+  // Parsing stops at the first argument that is not a flag, like a
+  // subcommand given after the flags, that would be silently ignored
+  if flag.CommandLine.NArg() > 0 {
+    log.Fatal("Error: unexpected argument ", flag.CommandLine.Arg(0),
+      " (the subcommand must come before the flags)")
+  }
+  // The profile fills in the flags that weren't given
+  if err := applyProfile(configName, profileName); err != nil {
+    log.Fatal("Error: ", err)
+  }
+  sec, err := readSecret()
+  if err != nil {
+    log.Fatal("Error: ", err)
   }
-  if horizonURL != "" {
-    client.URL = horizonURL
+  cfg.FunderSec = sec
+  if signerURL != "" {
+    cosigners = append(cosigners, cfg.FunderPub + "=" + signerURL)
   }
-
-  // Create the random Public-Secret keypairs
-  pairs := make(Voters, numAccounts)
-  for i, _ := range pairs {
-    p, err := keypair.Random()
-    fatalErr(err, "Error creating random keypair:")
-    pairs[i] = p
-    // fmt.Println(i, "-", p.Address(), p.Seed())
+  signers, err := readCosigners()
+  if err != nil {
+    log.Fatal("Error: ", err)
   }
-  // Defer saving the keypairs in a file, only if the file name is not ""
-  if outputFile != "" {
-    defer saveJSON(&pairs)
+  cfg.FunderSigners = signers
+  if cfg.FeePayer == "funder" {
+    cfg.FeePayer = cfg.FunderPub
   }
-  // Stop here if we want only to generate random accounts
-  if onlyGenerate {
-    return
+  cfg.FeePayerSec, err = readFeePayerSecret()
+  if err != nil {
+    log.Fatal("Error: ", err)
   }
-
-  // ##### ACCOUNT FUNDING PROCESS #####
-
-  // Set up the WaitGroup
-  guard := make(chan struct{}, WG_MAX)
-  // Set up the channel to store the indexes of successfully funded pairs
-  successChan := make(chan int, len(pairs))
-
-  // Fund all the accounts
-  if !livenet && useSink {
-    // Ask the friendbot to fund each pair, using goroutines
-    for i, p := range pairs {
-      // Use an empty struct to mark that a new goroutine will be used
-      // This blocks when guard is full
-      guard<- struct{}{}
-      wg.Add(1)
-      // Start the goroutine
-      go func(i int, p *keypair.Full, success chan int) {
-        defer wg.Done()
-        fmt.Println("Ask friendbot to fund #", i, "-", p.Address()) // TODO: Remove
-        // Returns true if the friendbot successfully funded p
-        if askFriendBot(p) {
-          success<- i
-        }
-        // Remove one element from the guard, allowing a new goroutine to run
-        <-guard
-      }(i, p, successChan)
-    }
-
-    // Wait for all the goroutines to finish
-    wg.Wait()
-    // Create a new slice to hold only the funded accounts
-    var tmp Voters
-    // Proccess the results
-    sinkProcess:
-    for {
-      select {
-      case i := <-successChan:
-        fmt.Println("- Keeping pair #", i, "-", fmt.Sprintf("%p", pairs[i]))
-        tmp = append(tmp, pairs[i])
-        break
-      default:
-        fmt.Println("- successChan is empty. Done!")
-        break sinkProcess
-      }
+  cfg.Passphrase = os.Getenv(PASSPHRASE_ENV)
+  if encrypt && cfg.Passphrase == "" {
+    p, err := askPassphrase()
+    if err != nil {
+      log.Fatal("Error: ", err)
     }
-    // Keep only the funded accounts in the pairs slice (and update numAccounts)
-    pairs = tmp
-    numAccounts = len(pairs)
-  } else {
-
-    // TODO: Testing...
-    funder := AccountFunder{
-      Min: minBal,
-      Max: maxBal,
-      Pub: funderPub,
-      Sec: funderSec,
+    cfg.Passphrase = p
+  }
+  // Only new accounts are derived, resumed ones are already in the journal
+  if mnemonic && (name == "generate" || name == "run" && !cfg.Resume) || name == "regenerate" {
+    m, err := readMnemonic(name)
+    if err != nil {
+      log.Fatal("Error: ", err)
     }
-    creator := TransactionCreator(funder)
-
-    // Fund the accounts from funderPub's balance, numOps per transaction
-    var succeeded Voters
-    for processed := 0; processed < len(pairs); {
-      // Indexes of the pairs that will be funded
-      a := processed
-      b := processed + numOps
-      // Make sure we don't overflow
-      if b > len(pairs) {
-        b = len(pairs)
-      }
-      fmt.Println("\nProcess from #", a, "to #", b-1)
-
-      // Get the Sequence number for the funder account
-      fmt.Println("Getting funder sequence number from horizon...")
-      sequence, err := getSequence(client, funderPub)
-      fatalErr(err, "Error getting funder's sequence from Horizon:")
-      fmt.Println("Sequence:", sequence - 1)
-
-      succeeded = append(succeeded, createAndSubmit(client, &creator, sequence, pairs[a:b])...)
-      fmt.Println("### SUCCEEDED:", len(succeeded))
-
-      // We have processed up to 'b' already
-      processed = b
+    cfg.Mnemonic = m
+    cfg.MnemonicPassword = os.Getenv(MNEMONIC_PASSWORD_ENV)
+  }
+  // Addresses are upper case, like the strings searched in them
+  cfg.Vanity.Prefix = strings.ToUpper(cfg.Vanity.Prefix)
+  cfg.Vanity.Suffix = strings.ToUpper(cfg.Vanity.Suffix)
+  if vanityMatch != "" {
+    re, err := regexp.Compile(vanityMatch)
+    if err != nil {
+      log.Fatal("Error: ", err)
     }
-
-    // TODO: Testing...
-    pairs = succeeded
-    numAccounts = len(pairs)
+    cfg.Vanity.Regexp = re
   }
-
-  // Read extra (funded) addresses from a file, only if its name is not ""
-  if inputFile != "" {
-    inputPairs := readJSON()
-    if inputPairs != nil {
-      pairs = append(pairs, (*inputPairs)...)
-      numAccounts += len(*inputPairs)
-    }
+  dist, err := distribution()
+  if err != nil {
+    log.Fatal("Error: ", err)
   }
-
-  // ##### INFLATION DESTINATION SETTING PROCESS #####
-
-  fmt.Println("\n### Set inflation destination\n")
-  ceil := math.Ceil(float64(numAccounts) / float64(SIGNERS_PER_TX_MAX))
-  // respChan := make(chan Response, int(ceil))
-  respChan := make(chan Voters, int(ceil))
-
-  // TODO: Testing...
-  inf := InflationSetter{
-    C: client,
-    InfDest: infDest,
+  cfg.Distribution = dist
+  if dryRunFile != "" {
+    cfg.DryRun = pool.NewDryRun()
   }
-  creator := TransactionCreator(inf)
-
-  // Set their Inflation Destination to the funder, 20 per transaction
-  for a := 0; a < numAccounts; a += SIGNERS_PER_TX_MAX {
-    // Indexes of the pairs that will have operations in the transaction
-    b := a + SIGNERS_PER_TX_MAX
-    // Make sure we don't overflow
-    if b > numAccounts {
-      b = numAccounts
-    }
-    fmt.Println("Setting from #", a, "to #", b-1)
-
-    // Use an empty struct to mark that a new goroutine will be used
-    // This blocks when guard is full
-    guard<- struct{}{}
-    wg.Add(1)
-    // Start the goroutine
-    go func(a int, b int, resp chan Voters) {
-      defer wg.Done()
-
-      resp<- createAndSubmit(client, &creator, 0, pairs[a:b])
-      <-guard
-    }(a, b, respChan)
+  if reportFile != "" {
+    cfg.Report = pool.NewReport()
   }
-
-  // Wait for all the goroutines to finish
-  wg.Wait()
-  fmt.Println("\nAll goroutines done! Proccessing results...")
-  // Proccess the results
-  var succeeded Voters
-  process:
-  for {
-    select {
-    case r := <-respChan:
-      succeeded = append(succeeded, r...)
-      fmt.Println("### SUCCEEDED:", len(r))
-      break
-    default:
-      fmt.Println("- respChan is empty. Done!")
-      break process
+  // The run command records its accounts in the journal (not on dry runs),
+  // opened before validating since resuming needs it
+  if name == "run" && journalFile != "" && cfg.DryRun == nil {
+    if cfg.Overwrite && !cfg.Resume {
+      os.Remove(journalFile + ".jsonl")
     }
-  }
-
-  pairs = succeeded
-  fmt.Println("### Final succeeded:", len(pairs))
-}
-
-// TODO: It should also return res (type *horizon.TransactionSuccess)
-func createAndSubmit(c *horizon.Client, src *TransactionCreator, seq uint64, pairs Voters) (Voters) {
-  // Create and submit the transaction (retry if some operations fail)
-  for count := 1; ; count, seq = count + 1, seq + 1 {
-    // Get the signed Transaction Envelope
-    xdr, notOk := (*src).CreateTransaction(seq, pairs)
-    // Failed to create the transaction, no pair succeeded, stop trying
-    if notOk {return Voters{}}
-
-    // Submit the transaction
-    res, err := submit(c, xdr)
-    if logErr(err, "CreateAccount submission error (try #" + strconv.Itoa(count) + "):") {
-      // Log the XDR of the failed transaction
-      log.Println("XDR of the failed transaction:", xdr)
-      // Log the specific Horizon errors and get the Transaction Codes
-      codes, notOk := checkHorizonError(err)
-      // The error is not from horizon, or it didn't fail because of the operations
-      if notOk || codes.TransactionCode != "tx_failed" {
-        return Voters{}
-      }
-
-      // Make pairs point to a new slice, with only the successfull elements
-      var tmp Voters
-      for i, c := range codes.OperationCodes {
-        if c == "op_success" {
-          tmp = append(tmp, pairs[i])
-        }
-      }
-      // Try again with the updated pairs
-      pairs = tmp
-    } else {
-      // Transaction was successfull (with maybe less voters in pairsCopy)
-      fmt.Println("Transaction Sent! Number of pairs:", len(pairs))
-      fmt.Println("\tLedger:", res.Ledger)
-      fmt.Println("\tHash:", res.Hash)
-      // fmt.Println("\tResult:", res.Result)
-
-      // Transaction submission was successfull, get out of loop
-      break
+    cfg.Journal, err = pool.OpenJournal(journalFile, cfg.Resume, cfg.Passphrase)
+    if err != nil {
+      log.Fatal("Error: ", err)
     }
   }
-
-  // Return whatever pairs remain (the ones that succeeded)
-  return pairs
-}
-
-
-func (m AccountFunder) CreateTransaction(seq uint64, dest []*keypair.Full) (string, bool) {
-  // Create a mutator for each createAccount operation
-  muts := make([]build.TransactionMutator, len(dest))
-  for i, p := range dest {
-    // Calculate the initial balance for the operation
-    r := float64(m.Min + rand.Intn(m.Max - m.Min)) / 10000000.0
-    amount := strconv.FormatFloat(r, 'f', -1, 64)
-    // fmt.Println("Adding OP - Create", p.Address(), "With", amount, "XLM")
-
-    // Add the operation to the slice
-    muts[i] = build.CreateAccount(
-      build.Destination{ p.Address() },
-      build.NativeAmount{ amount },
-    )
-
-    // TODO: Remove - just testing operation failures
-    // x := rand.Intn(100)
-    // if x < 2 {
-    //   fmt.Println("@@@@ Introducing invalid @@@@", x)
-    //   muts[i] = build.CreateAccount(
-    //     build.Destination{ "GCBOIVJS44UAVOBLUHR6EXHOKPPNZXDP3IMOZOQ7LKGX3ZZX2SOHJB7B" }, //INVALID!
-    //     build.NativeAmount{ amount },
-    //   )
-    // } else {
-    //   muts[i] = build.CreateAccount(
-    //     build.Destination{ p.Address() },
-    //     build.NativeAmount{ amount },
-    //   )
-    // }
-    // TODO: End-Remove
-  }
-
-  // Create the transaction with these mutators and get the XDR
-  tx, notOk := createTx(m.Pub, seq, m.Pub[len(m.Pub)-8:] + " funding accounts", []string{m.Sec}, muts...)
-  if notOk {
-    return "", true
-  } else {
-    return tx, false
-  }
-}
-
-
-func (m InflationSetter) CreateTransaction(seq uint64, dest []*keypair.Full) (string, bool) {
-  // There must be at least one keypair to create the transaction
-  if len(dest) <= 0 { return "", true }
-
-  // Get the sequence number of the first pair (ignore the 'seq' received)
-  pub := dest[0].Address()
-  seq, err := getSequence(m.C, pub)
-  if logErr(err, "Error getting sequence from Horizon:") {return "", true}
-  fmt.Println(pub, "sequence:", seq)
-
-  // Create a mutator for each setOptions operation
-  muts := make([]build.TransactionMutator, len(dest))
-  signers := make([]string, len(dest))
-  for i, p := range dest {
-    muts[i] = build.SetOptions(
-      build.SourceAccount{ p.Address() },
-      build.InflationDest(m.InfDest),
-    )
-    // Also save this pair secret key as a signer
-    signers[i] = p.Seed()
+  if err := cfg.Validate(); err != nil {
+    log.Fatal("Error: ", err)
   }
 
-  // Create the transaction with these mutators and get the XDR
-  tx, notOk := createTx(pub, seq, "Voting for " + m.InfDest[len(m.InfDest)-8:], signers, muts...)
-  if notOk {
-    return "", true
-  } else {
-    return tx, false
+  err = commands[name](context.Background())
+  if cfg.Journal != nil {
+    cfg.Journal.Close()
   }
-}
-
-// General function to create transactions, checking each step along the way
-func createTx(src string, seq uint64, memo string, signers []string, muts ...build.TransactionMutator) (string, bool) {
-  // fmt.Println("Creating TX - src:", src, "- seq:", seq)
-  // Choose the network passphrase
-  var network build.Network
-  if livenet {
-    network = build.PublicNetwork
-  } else {
-    network = build.TestNetwork
+  if cfg.DryRun != nil {
+    cfg.DryRun.Save(dryRunFile)
   }
-
-  // Create the base transaction
-  tx, err := build.Transaction(
-    build.SourceAccount{ src },
-    build.Sequence{ seq },
-    build.MemoText{ memo },
-    network,
-  )
-  if logErr(err, "Error building base transaction:") {return "", true}
-
-  // Set the operations (received as a slice of TransactionMutators)
-  err = tx.Mutate(muts...)
-  if logErr(err, "Error mutating transaction:") {return "", true}
-
-  // Run the default mutations, such as calculating the Fee
-  err = tx.Mutate(build.Defaults{})
-  if logErr(err, "Error applying default mutations:") {return "", true}
-
-  // Sign the transaction with the slice of private keys received
-  txe, err := tx.Sign(signers...)
-  if logErr(err, "Error signing the transaction:") {return "", true}
-
-  // Get the XDR in Base64 from the Transaction Envelope
-  txb64, err := txe.Base64()
-  if logErr(err, "Error getting XDR from the Tx envelope:") {return "", true}
-
-  // The transaction is finally done!
-  return txb64, false
-}
-
-func submit(client *horizon.Client, xdr string) (*horizon.TransactionSuccess, error) {
-  var err error
-  var res horizon.TransactionSuccess
-  // Try susbmitting the transaction
-  for retry, count := true, 1; retry; count++ {
-    res, err = client.SubmitTransaction(xdr)
-    // Type assertion to test if err is from Horizon (herr is nil if err is nil)
-    herr, isHorizonErr := err.(*horizon.Error)
-    // Wait some time and retry, if we got Status 504 (Gateway Timeout
-    if isHorizonErr && herr.Problem.Status == 504 {
-      log.Println("Horizon timed out:", herr.Problem.Type)
-      time.Sleep(TIMEOUT_WAIT_SECONDS * time.Second)
-      log.Println("Re-submitting...")
-      continue
+  // Only the commands that submit transactions have something to report
+  if cfg.Report != nil && submits[name] {
+    // Commands that stopped before their phase still report the error
+    if cfg.Report.Finished.IsZero() {
+      cfg.Report.Finish(cfg.Journal, err)
     }
-    // Do not retry, err == nil or it was not a timeout
-    retry = false
-  }
-  return &res, err
-}
-
-func getSequence(client *horizon.Client, address string) (uint64, error) {
-  // Get the Sequence number for an account
-  // Returned type: xdr.SequenceNumber -> xdr.Int64 -> int64
-  seq, err := client.SequenceForAccount(address)
-  if err != nil || seq < 0 {
-    return 0, err
+    cfg.Report.Save(reportFile)
   }
-  sequence := uint64(seq) + 1
-  return sequence, nil
-}
-
-func askFriendBot(p *keypair.Full) bool {
-  resp, err := http.Get(TESTNET_FRIENDBOT_URL + p.Address())
-  if logErr(err, "Error funding account with the friendbot:") {
-    return false
-  }
-  defer resp.Body.Close()
-
-  fmt.Println("Pair:", fmt.Sprintf("%p", p), "- Addr:", p.Address(), "- Response:", resp.StatusCode, "-", resp.Status) // TODO: Remove
-  // Maybe the 'if' should test for StatusCode != 200 ?
-  if resp.StatusCode < 200 || resp.StatusCode > 299 {
-    body, err := ioutil.ReadAll(resp.Body)
-    if !logErr(err, "Error reading the body of the friendbot's response:") {
-      log.Println("Status", resp.Status, "funding", p.Address(), "on FriendBot")
-      log.Println(string(body))
-    }
-    return false
+  if err != nil {
+    log.Println("Error:", err)
+    os.Exit(1)
   }
-  // This means the friendbot returned any status code between 200 and 299 (success)
-  return true
 }
 
-func readJSON() *Voters {
-  fmt.Println("\nReading", inputFile, "...")
-  // Open the JSON file
-  f, err := os.Open(inputFile + ".json")
-  if logErr(err, "Error opening " + inputFile + ".json:") { return nil }
-  defer f.Close()
-
-  // Create the keypairs slice to append the data
-  var keypairs Voters
-
-  // Create a JSON decoder and Unmarshall the file
-  dec := json.NewDecoder(f)
-  // Start the array by reading an open bracket ('[')
-  t, err := dec.Token()
-  if logErr(err, "Error getting token '[' from file:") || t != json.Delim('[') {
-    log.Println("Decoding JSON file: Wrong token. Expected '[', got:", t)
-    return nil
-  }
-  // While the array contain JSON values
-  for dec.More() {
-    // Decode the voter
-    var v VoterJSON
-    err = dec.Decode(&v)
-    if logErr(err, "Error decoding voter:") { return nil }
-
-    // Get a keypair from the decoded secret seed
-    kp, err := keypair.Parse(v.Sec)
-    if !logErr(err, "Error parsing keypair from decoded voter:") {
-      // Assert type
-      pointer, ok := kp.(*keypair.Full)
-      if ok {
-        // Append keypair to slice
-        keypairs = append(keypairs, pointer)
-      }
-    }
-  }
-  // Finish the array by reading a closing bracket (']')
-  t, err = dec.Token()
-  if logErr(err, "Error getting token ']' from file:") || t != json.Delim(']') {
-    log.Println("Decoding JSON file: Wrong token. Expected ']', got:", t)
-    return nil
-  }
-
-  return &keypairs
+// The -min and -max flags only limit the normal and lognormal distributions
+// when given, their defaults (for uniform) would pile the tails on 4 and 6 XLM
+func givenFlag(name string) bool {
+  given := false
+  flag.Visit(func(f *flag.Flag) { given = given || f.Name == name })
+  return given
 }
 
-func saveJSON(pairsPointer *Voters) {
-  fmt.Println("\nSaving", pairsPointer, "...")
-  // Iterate all the voters and prepare the JSON struct
-  // var jsonStruct VotersJSON
-  // jsonStruct.Pool = infDest
-  var jsonVoters []VoterJSON
-  for _, p := range *pairsPointer {
-    // jsonStruct.Voters = append(jsonStruct.Voters, VoterJSON
-    jsonVoters = append(jsonVoters, VoterJSON{
-      Pub: p.Address(),
-      Sec: p.Seed(),
-    })
-  }
-
-  // Create/truncate the file to save the keypairs (if error, dump data on logs)
-  f, err := os.Create(outputFile + ".json")
-  if logDumpData(err, jsonVoters, "Error creating " + outputFile + ".json:") {
-    return
-  }
-  defer f.Close()
-
-  // Create a JSON encoder with the file and Marshal the structure
-  enc := json.NewEncoder(f)
-  enc.SetIndent("", " ")
-  err = enc.Encode(jsonVoters)
-  // In case of errors, try to save the data in Go's format (no JSON)
-  if logErr(err, "Error encoding JSON: ") {
-    log.Println("Trying to save data in Go's format...")
-    _, err = fmt.Fprintf(f, "%#v", jsonVoters)
-    // If it still errors, just dump the data in the log
-    logDumpData(err, jsonVoters, "Error saving data to the file:")
-  }
+// -min, or the smallest balance if not given
+func givenMin() int64 {
+  if !givenFlag("min") { return pool.ACCOUNT_BALANCE_MIN }
+  return cfg.MinBalance
 }
 
-func logErr(err error, message string) bool {
-  if err != nil {
-    log.Println(message, err)
-    return true
-  } else {
-    return false
-  }
+// -max, or 0 (no limit) if not given
+func givenMax() int64 {
+  if !givenFlag("max") { return 0 }
+  return cfg.MaxBalance
 }
 
-func checkHorizonError(err error) (*horizon.TransactionResultCodes, bool) {
-  // Type assertion to test if err is from Horizon (herr is nil if err is nil)
-  herr, isHorizonErr := err.(*horizon.Error)
-  if !isHorizonErr {return nil, true}
-
-  // Log the Horizon Error Status
-  log.Println("\tError Status:", herr.Problem.Status, herr.Problem.Type)
-
-  // Log the Transaction Result String (base64)
-  str, err := herr.ResultString()
-  if !logErr(err, "\tError extracting the result string from the Horizon Error:") {
-    log.Println("\tTransaction result XDR:", str)
-  }
-
-  // Get the Transaction Result Codes
-  codes, err := herr.ResultCodes()
-  if logErr(err, "\tError extracting the result codes from the Horizon Error:") {
-    return nil, true
-  }
-
-  // Log and return the Transaction Result Codes
-  log.Println("\tTransaction result code:", codes.TransactionCode, "(" + strconv.Itoa(len(codes.OperationCodes)) + " op_codes)")
-  for i, c := range codes.OperationCodes {
-    log.Println("\t\tOperation", i, "result code:", c)
-  }
-  return codes, false
+// Distribution of the initial funding picked in the flags
+func distribution() (pool.Distribution, error) {
+  switch distName {
+  case "fixed":
+    return pool.Fixed{Amount: mean}, nil
+  case "uniform":
+    // Uses -min and -max after they are validated
+    return nil, nil
+  case "normal":
+    return pool.Normal{Mean: mean, StdDev: stdDev, Min: givenMin(), Max: givenMax()}, nil
+  case "lognormal":
+    return pool.LogNormal{Mean: mean, StdDev: stdDev, Min: givenMin(), Max: givenMax()}, nil
+  case "csv":
+    amounts, err := pool.ReadCSVAmounts(amountsFile)
+    if err != nil { return nil, err }
+    return amounts, nil
+  }
+  return nil, errors.New("unknown distribution " + distName)
 }
 
-func logDumpData(err error, data interface{}, message string) bool {
-  if logErr(err, message) {
-    log.Printf("## DATA DUMP ##\n%#v\n", data)
-    return true
-  } else {
-    return false
-  }
+// Asks for the passphrase twice in the terminal, without echoing it
+func askPassphrase() (string, error) {
+  fd := int(os.Stdin.Fd())
+  fmt.Fprint(os.Stderr, "Passphrase: ")
+  p, err := terminal.ReadPassword(fd)
+  fmt.Fprintln(os.Stderr)
+  if err != nil { return "", err }
+  fmt.Fprint(os.Stderr, "Repeat the passphrase: ")
+  again, err := terminal.ReadPassword(fd)
+  fmt.Fprintln(os.Stderr)
+  if err != nil { return "", err }
+
+  if len(p) == 0 { return "", errors.New("empty passphrase") }
+  if string(p) != string(again) { return "", errors.New("the passphrases don't match") }
+  return string(p), nil
 }
 
-func fatalErr(err error, message string) {
-  if logErr(err, message) {
-    os.Exit(1)
+// Reads the mnemonic from the environment or the terminal. When generating,
+// a new mnemonic is created (and printed, to be written down) if none is given
+func readMnemonic(name string) (string, error) {
+  if m := os.Getenv(MNEMONIC_ENV); m != "" {
+    return m, nil
   }
+  create := name != "regenerate"
+  if create {
+    fmt.Fprint(os.Stderr, "Mnemonic (empty to create a new one): ")
+  } else {
+    fmt.Fprint(os.Stderr, "Mnemonic: ")
+  }
+  m, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+  fmt.Fprintln(os.Stderr)
+  if err != nil { return "", err }
+  if len(m) > 0 { return string(m), nil }
+  if !create { return "", errors.New("empty mnemonic") }
+
+  created, err := pool.NewMnemonic()
+  if err != nil { return "", err }
+  fmt.Fprintln(os.Stderr, "New mnemonic, write it down to recover the accounts:")
+  fmt.Fprintln(os.Stderr, created)
+  return created, nil
 }
@@ -0,0 +1,157 @@
+package pool
+
+import (
+  "os"
+  "log"
+  "sync"
+  "errors"
+  "context"
+  "strconv"
+)
+
+// Balance given to each channel account, in stroops (pays the fees)
+const CHANNEL_BALANCE = 20000000
+const PHASE_CHANNELS = "channels"
+
+// Funds the accounts with cfg.Channels channel accounts as the transaction
+// sources, so several batches are in flight at once. The funder is still the
+// source of the operations and signs them. The channels are created first,
+// and merged back into the funder at the end. Each transaction funds size pairs
+func fundWithChannels(ctx context.Context, cfg Config, client Horizon, pairs Voters, amounts map[string]int64, signers []Signer, size int) (Voters, error) {
+  var wg sync.WaitGroup
+  channels, err := openChannels(cfg)
+  if err != nil { return nil, err }
+  // The merges at the end can't fail on their memo, after the channels
+  // were funded
+  err = cfg.checkMemo(cfg.MergeMemo, MERGE_MEMO, cfg.FunderPub, len(channels), SIGNERS_PER_TX_MAX)
+  if err != nil { return nil, err }
+  sub := cfg.submitter(client, PHASE_CHANNELS)
+
+  // Create the channels, in one transaction from the funder
+  channelAmounts, err := Fixed{CHANNEL_BALANCE}.Amounts(channels)
+  if err != nil { return nil, err }
+  channelFunder := TransactionCreator(AccountFunder{
+    Amounts: channelAmounts,
+    Pub: cfg.FunderPub,
+    Sec: cfg.FunderSec,
+    Signers: signers,
+    Network: cfg.network(),
+    Memo: cfg.memo(cfg.FundMemo),
+  })
+  created, _, failed := sub.createAndSubmit(&channelFunder, 0, channels)
+  // Channels left by an interrupted run can be used as they are
+  for _, ch := range channels {
+    if failed[ch.Address()] == "op_already_exists" {
+      created = append(created, ch)
+    }
+  }
+  if len(created) == 0 {
+    return nil, errors.New("no channel account could be created")
+  }
+  log.Println("Funding with", len(created), "channels")
+
+  // Each channel takes batches of size pairs (by their first index)
+  // until there are no more
+  batches := make(chan int)
+  var mu sync.Mutex
+  var succeeded Voters
+  fundSub := cfg.submitter(client, PHASE_FUND)
+  fundSub.seqs = sub.seqs
+  for _, ch := range created {
+    creator := TransactionCreator(AccountFunder{
+      Amounts: amounts,
+      Pub: cfg.FunderPub,
+      Sec: cfg.FunderSec,
+      Signers: signers,
+      Network: cfg.network(),
+      Memo: cfg.memo(cfg.FundMemo),
+      Channel: ch,
+      InfDest: cfg.combinedInflationDest(),
+    })
+    wg.Add(1)
+    go func(creator TransactionCreator) {
+      defer wg.Done()
+      for a := range batches {
+        b := a + size
+        // Make sure we don't overflow
+        if b > len(pairs) {
+          b = len(pairs)
+        }
+        ok := fundBatch(cfg, fundSub, &creator, a / size, pairs[a:b])
+        mu.Lock()
+        succeeded = append(succeeded, ok...)
+        log.Println("### SUCCEEDED:", len(succeeded))
+        mu.Unlock()
+      }
+    }(creator)
+  }
+  for a := 0; a < len(pairs); a += size {
+    if ctx.Err() != nil { break }
+    batches<- a
+  }
+  close(batches)
+  wg.Wait()
+
+  // Return the channels' balance to the funder
+  err = mergeChannels(cfg, sub, created)
+  if err == nil {
+    err = ctx.Err()
+  }
+  return succeeded, err
+}
+
+// Loads the channels saved by an interrupted run (refusing to drop any),
+// generating the missing ones, and saves them before they receive any funds
+func openChannels(cfg Config) (Voters, error) {
+  var channels Voters
+  if cfg.ChannelsFile != "" {
+    if _, err := os.Stat(cfg.ChannelsFile + ".json"); err == nil {
+      channels, err = ReadJSON(cfg.ChannelsFile, cfg.Passphrase)
+      if err != nil { return nil, err }
+    }
+  }
+  // The extra channels may be funded, and the file has their only seeds
+  if len(channels) > cfg.Channels {
+    return nil, errors.New(cfg.ChannelsFile + ".json has " + strconv.Itoa(len(channels)) +
+      " channels of an interrupted run, use at least that many")
+  }
+  more, err := Generate(cfg.Channels - len(channels))
+  if err != nil { return nil, err }
+  channels = append(channels, more...)
+
+  // Dry runs don't send funds, so there is nothing to lose
+  if cfg.DryRun != nil { return channels, nil }
+  if cfg.ChannelsFile == "" {
+    return nil, errors.New("the channel keypairs must be saved, set ChannelsFile")
+  }
+  err = SaveJSON(cfg.ChannelsFile, channels, cfg.Passphrase)
+  return channels, err
+}
+
+// Merges the channels into the funder, SIGNERS_PER_TX_MAX per transaction.
+// The channels file is removed if all of them are merged
+func mergeChannels(cfg Config, sub *submitter, channels Voters) error {
+  merger := TransactionCreator(AccountMerger{
+    Dest: cfg.FunderPub,
+    Network: cfg.network(),
+    Memo: cfg.memo(cfg.MergeMemo),
+  })
+  merged := 0
+  for a := 0; a < len(channels); a += SIGNERS_PER_TX_MAX {
+    b := a + SIGNERS_PER_TX_MAX
+    if b > len(channels) {
+      b = len(channels)
+    }
+    ok, _, _ := sub.createAndSubmit(&merger, a / SIGNERS_PER_TX_MAX, channels[a:b])
+    merged += len(ok)
+  }
+  log.Println("Merged", merged, "of", len(channels), "channels")
+  if merged < len(channels) {
+    return errors.New("some channel accounts were not merged, their keys are in " +
+      cfg.ChannelsFile + ".json")
+  }
+  if cfg.DryRun == nil && cfg.ChannelsFile != "" {
+    os.Remove(cfg.ChannelsFile + ".json")
+  }
+  return nil
+}
@@ -0,0 +1,271 @@
+package pool
+
+import (
+  "time"
+  "errors"
+  "strconv"
+  "net/http"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Config holds every setting used to generate, fund and set the
+// inflation destination of the pool accounts
+type Config struct {
+  // URL of the Horizon server ("" for the network's default)
+  HorizonURL string
+  // Horizon client to use instead of one for HorizonURL (optional)
+  Horizon Horizon
+  // URL used to ask the friendbot for funds, followed by the address
+  FriendbotURL string
+  // Run on Stellar's livenet instead of testnet
+  Livenet bool
+  // Passphrase of another network, like a private one (optional)
+  NetworkPassphrase string
+  // Address and secret seed of the account that funds the new ones
+  FunderPub string
+  FunderSec string
+  // Signers of the funder besides FunderSec, like RemoteSigners or the
+  // other keys of a multisig funder (optional)
+  FunderSigners []Signer
+  // Address to set as the inflation destination (default: FunderPub)
+  InflationDest string
+  // Inflation destination of the accounts moved to InflationDest by Migrate
+  MigrateFrom string
+  // Address the accounts are merged into when dissolving the pool
+  // (default: FunderPub)
+  MergeDest string
+  // Names (without the .json extension) of the account files, "" to skip
+  InputFile string
+  OutputFile string
+  // Encrypt the output with this passphrase, also used to decrypt the input
+  Passphrase string
+  // BIP-39 mnemonic the accounts are derived from with SEP-0005 paths,
+  // with its optional password ("" to generate random keypairs)
+  Mnemonic string
+  MnemonicPassword string
+  // Derivation index of the first account generated from Mnemonic
+  FirstIndex int
+  // Pattern the addresses of the random keypairs must match (optional)
+  Vanity Vanity
+  // Number of accounts to generate and operations in each transaction
+  NumAccounts int
+  NumOps int
+  // Range of the random initial funding of each account (in stroops),
+  // used when there is no Distribution
+  MinBalance int64
+  MaxBalance int64
+  // Picks the initial funding of each account (optional)
+  Distribution Distribution
+  // Spread exactly this many stroops across the accounts funded, in the
+  // proportions of the distribution (0 to disable)
+  TotalBalance int64
+  // Number of channel accounts used to fund in parallel (0 to fund serially)
+  Channels int
+  // Name of the file (without .json) where the channel keypairs are kept
+  ChannelsFile string
+  // Set the inflation destination in the transactions that fund the
+  // accounts, instead of in separate ones
+  Combined bool
+  // Account that pays the fees of the inflation transactions, as their
+  // source ("" for the first account of each batch). FeePayerSec signs for
+  // it, unless it is FunderPub, that signs like when funding
+  FeePayer string
+  FeePayerSec string
+  // Fee of each operation, in stroops (default: BASE_FEE_MIN)
+  BaseFee uint64
+  // Highest fee of each operation when raising it after tx_insufficient_fee
+  // (0 to never raise it)
+  MaxFee uint64
+  // Pay the fee in this field of Horizon's fee stats (like "mode" or "p90"),
+  // if higher than BaseFee ("" to always pay BaseFee)
+  FeeStats string
+  // Transactions expire this long after being built, so they can't land
+  // after being given up on (0 for no time bounds)
+  TxTimeout time.Duration
+  // Type of the memos (MEMO_TEXT if ""), and the templates of the memos of
+  // each kind of transaction ("" for the defaults, see Memo)
+  MemoType string
+  FundMemo string
+  InflationMemo string
+  MergeMemo string
+  // Identify the transactions of this run in the memos (RunID is the Unix
+  // time when the run started if "")
+  RunID string
+  PoolName string
+  // Use Stellar's friendbot as the funder, if working on testnet
+  UseSink bool
+  // Only generate new account keypairs, don't fund or set inflation
+  OnlyGenerate bool
+  // Record the signed transactions here instead of submitting them (optional)
+  DryRun *DryRun
+  // Record the state of every account here (optional)
+  Journal *Journal
+  // Continue the run recorded in Journal, instead of generating new accounts
+  Resume bool
+  // Replace the OutputFile of an earlier run, losing the seeds in it
+  Overwrite bool
+  // Record the transactions submitted here (optional)
+  Report *Report
+}
+
+// Validate clamps the numeric settings to valid ranges and checks the
+// settings that are used by every phase
+func (cfg *Config) Validate() error {
+  if cfg.NumAccounts < 0 { cfg.NumAccounts = 0 }
+  if cfg.NumOps < 1 { cfg.NumOps = 1 }
+  if cfg.NumOps > OPS_PER_TX_MAX { cfg.NumOps = OPS_PER_TX_MAX }
+  if cfg.Channels < 0 { cfg.Channels = 0 }
+  if cfg.Channels > OPS_PER_TX_MAX { cfg.Channels = OPS_PER_TX_MAX }
+  if cfg.MinBalance < ACCOUNT_BALANCE_MIN { cfg.MinBalance = ACCOUNT_BALANCE_MIN }
+  if cfg.MaxBalance < ACCOUNT_BALANCE_MIN + 1 { cfg.MaxBalance = ACCOUNT_BALANCE_MIN + 1 }
+  if cfg.MinBalance == cfg.MaxBalance { cfg.MaxBalance = cfg.MinBalance + 1 }
+  if cfg.MaxBalance < cfg.MinBalance {
+    tmp := cfg.MinBalance
+    cfg.MinBalance = cfg.MaxBalance
+    cfg.MaxBalance = tmp
+  }
+  if cfg.TxTimeout < 0 { cfg.TxTimeout = 0 }
+  if cfg.BaseFee < BASE_FEE_MIN { cfg.BaseFee = BASE_FEE_MIN }
+  if cfg.MaxFee != 0 && cfg.MaxFee < cfg.BaseFee { cfg.MaxFee = cfg.BaseFee }
+  if cfg.RunID == "" { cfg.RunID = strconv.FormatInt(time.Now().Unix(), 10) }
+  cfg.Report.setRunID(cfg.RunID)
+  if err := cfg.memo("").validate(); err != nil {
+    return err
+  }
+  if cfg.InflationDest == "" { cfg.InflationDest = cfg.FunderPub }
+  if cfg.MergeDest == "" { cfg.MergeDest = cfg.FunderPub }
+  if err := cfg.validateMemos(); err != nil {
+    return err
+  }
+  if cfg.FriendbotURL == "" { cfg.FriendbotURL = TESTNET_FRIENDBOT_URL }
+  if cfg.DryRun != nil && cfg.DryRun.Network.Passphrase == "" {
+    cfg.DryRun.Network = cfg.network()
+  }
+  if cfg.FunderSec != "" && (cfg.FunderSec[0] != 'S' || len(cfg.FunderSec) < 56) {
+    return errors.New("invalid secret key")
+  }
+  if cfg.Mnemonic != "" && !validMnemonic(cfg.Mnemonic) {
+    return errors.New("invalid mnemonic")
+  }
+  if cfg.Vanity.Enabled() && cfg.Mnemonic != "" {
+    return errors.New("vanity addresses can't be derived from a mnemonic")
+  }
+  if err := cfg.Vanity.validate(); err != nil {
+    return err
+  }
+  if cfg.DryRun != nil && cfg.Journal.Persistent() {
+    return errors.New("a dry run can't be recorded in a journal file")
+  }
+  if cfg.Resume && cfg.Journal == nil {
+    return errors.New("resuming requires a journal")
+  }
+  return nil
+}
+
+// Checks that there is a way to fund the accounts
+func (cfg *Config) validateFunder() error {
+  if cfg.FunderSec == "" && len(cfg.FunderSigners) == 0 && !(cfg.UseSink && !cfg.Livenet) {
+    return errors.New("provide a secret key, a signer or set UseSink (on testnet)")
+  }
+  return nil
+}
+
+// Number of pairs funded by each transaction. When combined, every pair
+// has two operations and signs its own, besides the funder's signers (and
+// the channel's)
+func (cfg *Config) fundBatchSize(signers []Signer) (int, error) {
+  if !cfg.Combined { return cfg.NumOps, nil }
+  size := SIGNERS_PER_TX_MAX - len(signers)
+  if cfg.Channels > 0 { size-- }
+  if size > cfg.NumOps / 2 { size = cfg.NumOps / 2 }
+  if size < 1 {
+    return 0, errors.New("combined transactions need at least 2 operations, and " +
+      "signatures to spare after the " + strconv.Itoa(len(signers)) + " of the funder")
+  }
+  return size, nil
+}
+
+// Inflation destination set by the funding transactions ("" if not combined)
+func (cfg *Config) combinedInflationDest() string {
+  if !cfg.Combined { return "" }
+  return cfg.InflationDest
+}
+
+// Builds the memo of every kind of transaction for the first batch, so
+// templates that are never valid fail early. Each phase checks its last
+// batch with checkMemo before sending anything
+func (cfg *Config) validateMemos() error {
+  memos := []struct{ template, def, dest string }{
+    {cfg.FundMemo, FUND_MEMO, cfg.FunderPub},
+    {cfg.InflationMemo, INFLATION_MEMO, cfg.InflationDest},
+    {cfg.MergeMemo, MERGE_MEMO, cfg.MergeDest},
+  }
+  for _, m := range memos {
+    if err := cfg.checkMemo(m.template, m.def, m.dest, 0, 1); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Builds the memo of the last batch of num operations, perTx per transaction
+// (the longest {batch}), failing if the template is too long or not a number
+// for MEMO_ID
+func (cfg *Config) checkMemo(template string, def string, dest string, num int, perTx int) error {
+  last := 0
+  if num > 0 {
+    last = (num - 1) / perTx
+  }
+  _, err := cfg.memo(template).mutator(def, last, dest)
+  return err
+}
+
+// Memo of the transactions with the template
+func (cfg *Config) memo(template string) Memo {
+  return Memo{
+    Type: cfg.MemoType,
+    Template: template,
+    RunID: cfg.RunID,
+    Pool: cfg.PoolName,
+  }
+}
+
+// Picks the initial funding of each pair, in stroops
+func (cfg *Config) amounts(pairs Voters) (map[string]int64, error) {
+  var d Distribution = Uniform{cfg.MinBalance, cfg.MaxBalance}
+  if cfg.Distribution != nil {
+    d = cfg.Distribution
+  }
+  if cfg.TotalBalance > 0 {
+    d = Target{d, cfg.TotalBalance}
+  }
+  return d.Amounts(pairs)
+}
+
+// Client returns cfg.Horizon if set, or a Horizon client for the network
+// in the configuration
+func (cfg *Config) Client() Horizon {
+  if cfg.Horizon != nil {
+    return cfg.Horizon
+  }
+  url := horizon.DefaultTestNetClient.URL
+  if cfg.Livenet {
+    url = horizon.DefaultPublicNetClient.URL
+  }
+  if cfg.HorizonURL != "" {
+    url = cfg.HorizonURL
+  }
+  return HorizonClient{&horizon.Client{URL: url, HTTP: http.DefaultClient}}
+}
+
+// Network passphrase used to sign the transactions
+func (cfg *Config) network() build.Network {
+  if cfg.NetworkPassphrase != "" {
+    return build.Network{cfg.NetworkPassphrase}
+  }
+  if cfg.Livenet {
+    return build.PublicNetwork
+  }
+  return build.TestNetwork
+}
@@ -0,0 +1,143 @@
+package pool
+
+import (
+  "log"
+  "sync"
+  "errors"
+  "context"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/amount"
+)
+
+// MergedAccount is an account merged when dissolving the pool
+type MergedAccount struct {
+  Pub string `json:"pub"`
+  // Native balance before the merge, in XLM (the fees are paid from it)
+  Balance string `json:"balance"`
+  Tx string `json:"tx"`
+}
+
+// DissolveReport has the accounts merged into Dest and the XLM recovered
+type DissolveReport struct {
+  Dest string `json:"destination"`
+  Total int `json:"total"`
+  // Sum of the balances of the merged accounts, in XLM, before paying the
+  // fees of the merges
+  Recovered string `json:"recovered"`
+  Merged []MergedAccount `json:"merged"`
+  // Result code of every account not merged, by address
+  Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Dissolve merges the accounts of pairs into cfg.MergeDest, retiring the
+// pool. Their balances are loaded first, and then they are merged
+// SIGNERS_PER_TX_MAX per transaction (WG_MAX at a time). Accounts that
+// don't exist fail with "not_found", and the ones that couldn't be loaded
+// with "load_error", only in the report
+func Dissolve(ctx context.Context, cfg Config, client Horizon, pairs Voters) (*DissolveReport, error) {
+  var wg sync.WaitGroup
+  err := cfg.Validate()
+  if err != nil { return nil, err }
+  err = cfg.checkMemo(cfg.MergeMemo, MERGE_MEMO, cfg.MergeDest, len(pairs), SIGNERS_PER_TX_MAX)
+  if err != nil { return nil, err }
+
+  // Merging into a missing account would fail every operation
+  dest := checkAccount(client, cfg.MergeDest, "")
+  if dest.Error != "" { return nil, errors.New(dest.Error) }
+  if !dest.Exists {
+    return nil, errors.New("the destination " + cfg.MergeDest + " doesn't exist")
+  }
+
+  // Load the balance of every account, to know how much each one returns
+  checks := make([]AccountCheck, len(pairs))
+  guard := make(chan struct{}, WG_MAX)
+  for i, p := range pairs {
+    if ctx.Err() != nil { break }
+    guard<- struct{}{}
+    wg.Add(1)
+    go func(i int, a string) {
+      defer wg.Done()
+      checks[i] = checkAccount(client, a, "")
+      <-guard
+    }(i, p.Address())
+  }
+  wg.Wait()
+  if ctx.Err() != nil { return nil, ctx.Err() }
+
+  report := &DissolveReport{
+    Dest: cfg.MergeDest,
+    Total: len(pairs),
+    Failed: make(map[string]string),
+  }
+  balances := make(map[string]string)
+  var existing Voters
+  for i, c := range checks {
+    switch {
+    case c.Error != "":
+      report.Failed[c.Pub] = "load_error"
+    case !c.Exists:
+      report.Failed[c.Pub] = "not_found"
+    default:
+      balances[c.Pub] = c.Balance
+      existing = append(existing, pairs[i])
+    }
+  }
+  // Only the report has them, their state in the journal is still right (or
+  // unknown, after a load error)
+
+  merger := TransactionCreator(AccountMerger{
+    Dest: cfg.MergeDest,
+    Network: cfg.network(),
+    Memo: cfg.memo(cfg.MergeMemo),
+  })
+  sub := cfg.submitter(client, PHASE_DISSOLVE)
+
+  // Merge them, SIGNERS_PER_TX_MAX per transaction
+  var mu sync.Mutex
+  for a := 0; a < len(existing); a += SIGNERS_PER_TX_MAX {
+    if ctx.Err() != nil { break }
+    b := a + SIGNERS_PER_TX_MAX
+    // Make sure we don't overflow
+    if b > len(existing) {
+      b = len(existing)
+    }
+    log.Println("Merging from #", a, "to #", b-1)
+
+    guard<- struct{}{}
+    wg.Add(1)
+    go func(a int, b int) {
+      defer wg.Done()
+      ok, txRes, failed := sub.createAndSubmit(&merger, a / SIGNERS_PER_TX_MAX, existing[a:b])
+      if txRes != nil {
+        cfg.Journal.Merged(ok, txRes.Hash)
+      }
+      cfg.Journal.Failed(PHASE_DISSOLVE, failed)
+
+      mu.Lock()
+      defer mu.Unlock()
+      for _, p := range ok {
+        report.Merged = append(report.Merged, MergedAccount{
+          Pub: p.Address(),
+          Balance: balances[p.Address()],
+          Tx: txRes.Hash,
+        })
+      }
+      for address, code := range failed {
+        report.Failed[address] = code
+      }
+      <-guard
+    }(a, b)
+  }
+  wg.Wait()
+
+  // Add up the balances in stroops, so nothing is lost rounding
+  var recovered xdr.Int64
+  for _, m := range report.Merged {
+    balance, err := amount.Parse(m.Balance)
+    if logErr(err, "Error parsing the balance of " + m.Pub + ":") { continue }
+    recovered += balance
+  }
+  report.Recovered = amount.String(recovered)
+  log.Println("### Merged:", len(report.Merged), "of", len(pairs))
+  return report, ctx.Err()
+}
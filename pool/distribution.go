@@ -0,0 +1,220 @@
+package pool
+
+import (
+  "os"
+  "io"
+  "math"
+  "errors"
+  "math/big"
+  "encoding/csv"
+  "github.com/stellar/go/amount"
+  "github.com/stellar/go/keypair"
+)
+
+// Smallest initial balance of an account, in stroops (1 XLM)
+const ACCOUNT_BALANCE_MIN = 10000000
+
+// Distribution picks the initial balance of the accounts being funded
+type Distribution interface {
+  // Amounts returns the balance of each pair, in stroops, by address
+  Amounts(pairs Voters) (map[string]int64, error)
+}
+
+// Every account gets the same Amount
+type Fixed struct {
+  Amount int64
+}
+
+// Amounts picked at random in [Min, Max)
+type Uniform struct {
+  Min int64
+  Max int64
+}
+
+// Amounts picked from a normal distribution, limited to [Min, Max]
+// (Max is ignored if 0)
+type Normal struct {
+  Mean int64
+  StdDev int64
+  Min int64
+  Max int64
+}
+
+// Amounts picked from a log-normal distribution with this Mean and StdDev,
+// so most accounts have a small balance and a few a large one. Limited to
+// [Min, Max] (Max is ignored if 0)
+type LogNormal struct {
+  Mean int64
+  StdDev int64
+  Min int64
+  Max int64
+}
+
+// Amounts read from a CSV file, by address or in the order of the pairs
+type CSVAmounts struct {
+  ByAddress map[string]int64
+  InOrder []int64
+}
+
+// Spreads exactly Total stroops across the accounts, in the proportions
+// picked by Dist (equally if nil). Every account gets at least
+// ACCOUNT_BALANCE_MIN
+type Target struct {
+  Dist Distribution
+  Total int64
+}
+
+func (d Fixed) Amounts(pairs Voters) (map[string]int64, error) {
+  if d.Amount < ACCOUNT_BALANCE_MIN {
+    return nil, errors.New("the fixed amount is below the minimum balance")
+  }
+  return pick(pairs, func() int64 { return d.Amount }), nil
+}
+
+func (d Uniform) Amounts(pairs Voters) (map[string]int64, error) {
+  if d.Min < ACCOUNT_BALANCE_MIN || d.Max <= d.Min {
+    return nil, errors.New("invalid range for the uniform amounts")
+  }
+  return pick(pairs, func() int64 { return d.Min + rnd.Int63n(d.Max - d.Min) }), nil
+}
+
+func (d Normal) Amounts(pairs Voters) (map[string]int64, error) {
+  if d.Mean <= 0 || d.StdDev < 0 {
+    return nil, errors.New("invalid mean or standard deviation for the normal amounts")
+  }
+  return pick(pairs, func() int64 {
+    r := float64(d.Mean) + float64(d.StdDev) * rnd.NormFloat64()
+    return clamp(r, d.Min, d.Max)
+  }), nil
+}
+
+func (d LogNormal) Amounts(pairs Voters) (map[string]int64, error) {
+  if d.Mean <= 0 || d.StdDev < 0 {
+    return nil, errors.New("invalid mean or standard deviation for the log-normal amounts")
+  }
+  // Parameters of the underlying normal distribution
+  ratio := float64(d.StdDev) / float64(d.Mean)
+  sigma := math.Sqrt(math.Log1p(ratio * ratio))
+  mu := math.Log(float64(d.Mean)) - sigma * sigma / 2
+  return pick(pairs, func() int64 {
+    return clamp(math.Exp(mu + sigma * rnd.NormFloat64()), d.Min, d.Max)
+  }), nil
+}
+
+func (d *CSVAmounts) Amounts(pairs Voters) (map[string]int64, error) {
+  amounts := make(map[string]int64, len(pairs))
+  next := 0
+  for _, p := range pairs {
+    a, ok := d.ByAddress[p.Address()]
+    if !ok {
+      if next >= len(d.InOrder) {
+        return nil, errors.New("no amount for " + p.Address() + " in the CSV file")
+      }
+      a = d.InOrder[next]
+      next++
+    }
+    amounts[p.Address()] = a
+  }
+  return amounts, nil
+}
+
+func (d Target) Amounts(pairs Voters) (map[string]int64, error) {
+  n := int64(len(pairs))
+  if n == 0 { return map[string]int64{}, nil }
+  if d.Total / n < ACCOUNT_BALANCE_MIN {
+    return nil, errors.New("the total is not enough for the minimum balance of every account")
+  }
+  dist := d.Dist
+  if dist == nil {
+    dist = Fixed{ACCOUNT_BALANCE_MIN}
+  }
+  weights, err := dist.Amounts(pairs)
+  if err != nil { return nil, err }
+
+  // Give the minimum to every account, and split the rest by weight,
+  // using big integers so the sum is exact
+  rest := big.NewInt(d.Total - n * ACCOUNT_BALANCE_MIN)
+  sum := new(big.Int)
+  for _, w := range weights {
+    sum.Add(sum, big.NewInt(w))
+  }
+  amounts := make(map[string]int64, len(pairs))
+  spread := int64(0)
+  for _, p := range pairs {
+    share := new(big.Int).Mul(rest, big.NewInt(weights[p.Address()]))
+    share.Quo(share, sum)
+    amounts[p.Address()] = ACCOUNT_BALANCE_MIN + share.Int64()
+    spread += share.Int64()
+  }
+  // The stroops lost rounding down are given one to each account
+  for i := int64(0); spread < rest.Int64(); i++ {
+    amounts[pairs[i % n].Address()]++
+    spread++
+  }
+  return amounts, nil
+}
+
+// ReadCSVAmounts loads the amounts (in XLM) from a CSV file with either
+// "address,amount" rows, used for that address, or "amount" rows, used in
+// order for the accounts without a row of their own
+func ReadCSVAmounts(name string) (*CSVAmounts, error) {
+  f, err := os.Open(name)
+  if logErr(err, "Error opening " + name + ":") { return nil, err }
+  defer f.Close()
+
+  d := &CSVAmounts{ByAddress: make(map[string]int64)}
+  r := csv.NewReader(f)
+  r.FieldsPerRecord = -1
+  r.TrimLeadingSpace = true
+  for {
+    row, err := r.Read()
+    if err == io.EOF { break }
+    if logErr(err, "Error reading " + name + ":") { return nil, err }
+    if len(row) == 0 || len(row) > 2 {
+      return nil, errors.New("invalid row in " + name + ", expected [address,]amount")
+    }
+    a, err := amount.Parse(row[len(row)-1])
+    if logErr(err, "Error parsing amount in " + name + ":") { return nil, err }
+    if a < ACCOUNT_BALANCE_MIN {
+      return nil, errors.New("amount " + row[len(row)-1] + " is below the minimum balance")
+    }
+    if len(row) == 2 {
+      // Never echo the row, it could have a secret seed
+      if !validAddress(row[0]) {
+        return nil, errors.New("invalid address in " + name + ", expected [address,]amount")
+      }
+      d.ByAddress[row[0]] = int64(a)
+    } else {
+      d.InOrder = append(d.InOrder, int64(a))
+    }
+  }
+  return d, nil
+}
+
+// True if address is a public key (not a secret seed)
+func validAddress(address string) bool {
+  kp, err := keypair.Parse(address)
+  if err != nil { return false }
+  _, ok := kp.(*keypair.FromAddress)
+  return ok
+}
+
+// Picks an amount for each pair
+func pick(pairs Voters, next func() int64) map[string]int64 {
+  amounts := make(map[string]int64, len(pairs))
+  for _, p := range pairs {
+    amounts[p.Address()] = next()
+  }
+  return amounts
+}
+
+// Rounds r to stroops, limited to [min, max] (no upper limit if max is 0)
+// and never below ACCOUNT_BALANCE_MIN
+func clamp(r float64, min int64, max int64) int64 {
+  if min < ACCOUNT_BALANCE_MIN { min = ACCOUNT_BALANCE_MIN }
+  if max > 0 && r > float64(max) { return max }
+  // Far more than there is, but keeps the conversion valid
+  if r > math.MaxInt64 / 2 { return math.MaxInt64 / 2 }
+  if r < float64(min) { return min }
+  return int64(math.Round(r))
+}
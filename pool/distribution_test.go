@@ -0,0 +1,153 @@
+package pool
+
+import (
+  "os"
+  "testing"
+  "strconv"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestTargetSum(t *testing.T) {
+  tests := []struct {
+    name string
+    dist Distribution
+    num int
+    total int64
+  }{
+    {"equal", nil, 7, 1000000000},
+    {"one account", nil, 1, 123456789},
+    {"fixed", Fixed{ACCOUNT_BALANCE_MIN}, 3, 100000001},
+    {"uniform", Uniform{Min: 40000000, Max: 60000000}, 25, 1234567891},
+    {"normal", Normal{Mean: 50000000, StdDev: 10000000}, 25, 999999999},
+    {"lognormal", LogNormal{Mean: 50000000, StdDev: 200000000}, 25, 10000000007},
+    {"only the minimum", LogNormal{Mean: 50000000, StdDev: 10000000}, 10, 10 * ACCOUNT_BALANCE_MIN},
+  }
+  for _, test := range tests {
+    pairs, err := Generate(test.num)
+    if err != nil { t.Fatal(err) }
+    amounts, err := Target{Dist: test.dist, Total: test.total}.Amounts(pairs)
+    if err != nil {
+      t.Errorf("%s: %v", test.name, err)
+      continue
+    }
+    sum := int64(0)
+    for _, p := range pairs {
+      a := amounts[p.Address()]
+      if a < ACCOUNT_BALANCE_MIN {
+        t.Errorf("%s: %s gets %d, below the minimum", test.name, p.Address(), a)
+      }
+      sum += a
+    }
+    if len(amounts) != test.num || sum != test.total {
+      t.Errorf("%s: %d amounts add up to %d, expected %d and %d", test.name, len(amounts), sum, test.num, test.total)
+    }
+  }
+}
+
+func TestTargetBelowMinimum(t *testing.T) {
+  pairs, err := Generate(10)
+  if err != nil { t.Fatal(err) }
+  _, err = Target{Total: 10 * ACCOUNT_BALANCE_MIN - 1}.Amounts(pairs)
+  if err == nil {
+    t.Errorf("spread a total below the minimum balance of every account")
+  }
+}
+
+func TestReadCSVAmounts(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pool")
+  if err != nil { t.Fatal(err) }
+  defer os.RemoveAll(dir)
+  pairs, err := Generate(1)
+  if err != nil { t.Fatal(err) }
+  address := pairs[0].Address()
+
+  tests := []struct {
+    name string
+    csv string
+    byAddress int64
+    inOrder []int64
+    ok bool
+  }{
+    {"by address", address + ",5\n", 50000000, nil, true},
+    {"in order", "5\n2.5\n", 0, []int64{50000000, 25000000}, true},
+    {"both", "5\n" + address + ", 1.5\n", 15000000, []int64{50000000}, true},
+    {"header", "address,amount\n" + address + ",5\n", 0, nil, false},
+    {"too many fields", address + ",5,5\n", 0, nil, false},
+    {"not a number", "five\n", 0, nil, false},
+    {"below the minimum", "0.9999999\n", 0, nil, false},
+    {"invalid address", "GABC,5\n", 0, nil, false},
+    {"secret seed", pairs[0].Seed() + ",5\n", 0, nil, false},
+    {"unterminated quote", "\"5\n", 0, nil, false},
+  }
+  for i, test := range tests {
+    name := filepath.Join(dir, strconv.Itoa(i) + ".csv")
+    err := ioutil.WriteFile(name, []byte(test.csv), 0600)
+    if err != nil { t.Fatal(err) }
+    d, err := ReadCSVAmounts(name)
+    if !test.ok {
+      if err == nil { t.Errorf("%s: read %q without an error", test.name, test.csv) }
+      continue
+    }
+    if err != nil {
+      t.Errorf("%s: %v", test.name, err)
+      continue
+    }
+    if d.ByAddress[address] != test.byAddress || len(d.InOrder) != len(test.inOrder) {
+      t.Errorf("%s: read %v and %v", test.name, d.ByAddress, d.InOrder)
+      continue
+    }
+    for j, a := range test.inOrder {
+      if d.InOrder[j] != a {
+        t.Errorf("%s: amount %d is %d, expected %d", test.name, j, d.InOrder[j], a)
+      }
+    }
+  }
+}
+
+func TestClamp(t *testing.T) {
+  tests := []struct {
+    r float64
+    min int64
+    max int64
+    expected int64
+  }{
+    {50000000.4, 40000000, 60000000, 50000000},
+    {50000000.5, 40000000, 60000000, 50000001},
+    {1, 40000000, 60000000, 40000000},
+    {70000000, 40000000, 60000000, 60000000},
+    // No upper limit
+    {70000000, 40000000, 0, 70000000},
+    // Never below the minimum balance
+    {1, 0, 0, ACCOUNT_BALANCE_MIN},
+    {-5, 0, 60000000, ACCOUNT_BALANCE_MIN},
+    {1e30, 0, 0, 1<<62 - 1},
+  }
+  for _, test := range tests {
+    if a := clamp(test.r, test.min, test.max); a != test.expected {
+      t.Errorf("clamp(%v, %d, %d) = %d, expected %d", test.r, test.min, test.max, a, test.expected)
+    }
+  }
+}
+
+func TestNormalLimits(t *testing.T) {
+  pairs, err := Generate(100)
+  if err != nil { t.Fatal(err) }
+  // Wide enough for both limits to be hit
+  dists := []struct {
+    name string
+    dist Distribution
+  }{
+    {"normal", Normal{Mean: 50000000, StdDev: 100000000, Min: 40000000, Max: 60000000}},
+    {"lognormal", LogNormal{Mean: 50000000, StdDev: 500000000, Min: 40000000, Max: 60000000}},
+  }
+  for _, d := range dists {
+    amounts, err := d.dist.Amounts(pairs)
+    if err != nil { t.Fatal(err) }
+    for _, a := range amounts {
+      if a < 40000000 || a > 60000000 {
+        t.Errorf("%s: picked %d, outside [40000000, 60000000]", d.name, a)
+      }
+    }
+  }
+}
@@ -0,0 +1,147 @@
+package pool
+
+import (
+  "os"
+  "log"
+  "sync"
+  "strconv"
+  "encoding/hex"
+  "encoding/json"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/amount"
+  "github.com/stellar/go/network"
+)
+
+// DryRun records the signed transactions instead of submitting them,
+// projecting the sequence numbers locally as if every operation succeeded
+type DryRun struct {
+  Network build.Network
+  Transactions []DryRunTransaction
+  mu sync.Mutex
+  // Next sequence number of each transaction source
+  seqs map[string]uint64
+}
+
+// DryRunTransaction is a recorded transaction and a summary of its contents
+type DryRunTransaction struct {
+  Hash string `json:"hash"`
+  Source string `json:"source"`
+  Sequence uint64 `json:"sequence"`
+  Memo string `json:"memo,omitempty"`
+  Operations []string `json:"operations"`
+  Envelope string `json:"envelope_xdr"`
+}
+
+// NewDryRun returns an empty DryRun. Its Network is set by Config.Validate
+func NewDryRun() *DryRun {
+  return &DryRun{
+    seqs: make(map[string]uint64),
+  }
+}
+
+// Sequence returns the projected sequence number for the next transaction of
+// address. Accounts created in the dry run start at 1, but the real sequence
+// depends on the ledger they are created in, so those transactions will
+// have to be built again
+func (d *DryRun) Sequence(c Horizon, address string) (uint64, error) {
+  d.mu.Lock()
+  seq, ok := d.seqs[address]
+  d.mu.Unlock()
+  if ok { return seq, nil }
+
+  seq, err := getSequence(c, address)
+  if err != nil { return 0, err }
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.seqs[address] = seq
+  return seq, nil
+}
+
+// Assume the account was created, so its sequence can be projected
+func (d *DryRun) created(address string) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  if _, ok := d.seqs[address]; !ok {
+    d.seqs[address] = 1
+  }
+}
+
+// Record decodes and stores the base64 transaction envelope, returning
+// the transaction hash (hex encoded)
+func (d *DryRun) Record(txb64 string) (string, error) {
+  var env xdr.TransactionEnvelope
+  err := xdr.SafeUnmarshalBase64(txb64, &env)
+  if err != nil { return "", err }
+  hash, err := network.HashTransaction(&env.Tx, d.Network.Passphrase)
+  if err != nil { return "", err }
+
+  tx := DryRunTransaction{
+    Hash: hex.EncodeToString(hash[:]),
+    Source: env.Tx.SourceAccount.Address(),
+    Sequence: uint64(env.Tx.SeqNum),
+    Envelope: txb64,
+  }
+  switch {
+  case env.Tx.Memo.Text != nil:
+    tx.Memo = *env.Tx.Memo.Text
+  case env.Tx.Memo.Id != nil:
+    tx.Memo = strconv.FormatUint(uint64(*env.Tx.Memo.Id), 10)
+  case env.Tx.Memo.Hash != nil:
+    tx.Memo = hex.EncodeToString(env.Tx.Memo.Hash[:])
+  }
+  for _, op := range env.Tx.Operations {
+    tx.Operations = append(tx.Operations, summarizeOp(tx.Source, op))
+    if op.Body.Type == xdr.OperationTypeCreateAccount {
+      dest := op.Body.MustCreateAccountOp().Destination
+      d.created(dest.Address())
+    }
+  }
+
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  d.Transactions = append(d.Transactions, tx)
+  d.seqs[tx.Source] = tx.Sequence + 1
+  return tx.Hash, nil
+}
+
+// Save writes the recorded transactions to the file name + ".json"
+func (d *DryRun) Save(name string) error {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  log.Println("Saving", len(d.Transactions), "transactions to", name + ".json", "...")
+  f, err := os.Create(name + ".json")
+  if logErr(err, "Error creating " + name + ".json:") { return err }
+  defer f.Close()
+
+  enc := json.NewEncoder(f)
+  enc.SetIndent("", " ")
+  err = enc.Encode(d.Transactions)
+  logErr(err, "Error encoding JSON:")
+  return err
+}
+
+// One line description of an operation, like "create_account GABC... 5 XLM"
+func summarizeOp(txSource string, op xdr.Operation) string {
+  src := txSource
+  if op.SourceAccount != nil {
+    src = op.SourceAccount.Address()
+  }
+  switch op.Body.Type {
+  case xdr.OperationTypeCreateAccount:
+    o := op.Body.MustCreateAccountOp()
+    return "create_account " + o.Destination.Address() +
+      " " + amount.String(o.StartingBalance) + " XLM from " + src
+  case xdr.OperationTypeSetOptions:
+    o := op.Body.MustSetOptionsOp()
+    if o.InflationDest != nil {
+      return "set_options " + src + " inflation_dest " + o.InflationDest.Address()
+    }
+    return "set_options " + src
+  case xdr.OperationTypeAccountMerge:
+    dest := op.Body.MustDestination()
+    return "account_merge " + src + " into " + dest.Address()
+  default:
+    return "operation type " + strconv.Itoa(int(op.Body.Type)) + " from " + src
+  }
+}
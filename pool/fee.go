@@ -0,0 +1,63 @@
+package pool
+
+import (
+  "sync"
+  "errors"
+)
+
+// Smallest fee of each operation, in stroops
+const BASE_FEE_MIN = 100
+
+// Fee per operation used by a submitter, raised when the network is congested
+type feeLevel struct {
+  mu sync.Mutex
+  fee uint64
+  // The fee is never raised above max (never raised if 0)
+  max uint64
+}
+
+func (f *feeLevel) get() uint64 {
+  f.mu.Lock()
+  defer f.mu.Unlock()
+  return f.fee
+}
+
+// Doubles the fee (up to the max), unless another transaction already raised
+// it above from. Returns false if it can't be raised
+func (f *feeLevel) raise(from uint64) (uint64, bool) {
+  f.mu.Lock()
+  defer f.mu.Unlock()
+  if f.fee > from { return f.fee, true }
+  if f.fee >= f.max { return f.fee, false }
+  f.fee *= 2
+  if f.fee > f.max {
+    f.fee = f.max
+  }
+  return f.fee, true
+}
+
+// Fee per operation of new transactions: cfg.BaseFee, or the fee in the
+// cfg.FeeStats field of Horizon's /fee_stats if higher, limited to cfg.MaxFee
+func (cfg *Config) baseFee(client Horizon) uint64 {
+  fee := cfg.BaseFee
+  if cfg.FeeStats != "" {
+    stat, err := feeStats(client, cfg.FeeStats)
+    if !logErr(err, "Error getting the fee stats, using the base fee:") && stat > fee {
+      fee = stat
+    }
+  }
+  if cfg.MaxFee > 0 && fee > cfg.MaxFee {
+    fee = cfg.MaxFee
+  }
+  return fee
+}
+
+// Gets the stat (like "mode" or "p90") of the fees accepted in the last
+// ledgers, from the /fee_stats endpoint
+func feeStats(client Horizon, stat string) (uint64, error) {
+  stats, err := client.FeeStats()
+  if err != nil { return 0, err }
+  fee, ok := stats[stat + "_accepted_fee"]
+  if !ok { return 0, errors.New("no " + stat + "_accepted_fee in the fee stats") }
+  return fee, nil
+}
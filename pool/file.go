@@ -0,0 +1,173 @@
+package pool
+
+import (
+  "os"
+  "fmt"
+  "log"
+  "bytes"
+  "errors"
+  "io/ioutil"
+  "path/filepath"
+  "encoding/json"
+  "github.com/stellar/go/keypair"
+)
+
+type VoterJSON struct{
+  Pub string `json:"pub"`
+  Sec string `json:"sec"`
+  // SEP-0005 derivation index, if derived from a mnemonic
+  Index *int `json:"index,omitempty"`
+  // Result of the run for the account, written at the end of a Run
+  Status string `json:"status,omitempty"`
+  FundTx string `json:"fund_tx,omitempty"`
+  InflationTx string `json:"inflation_tx,omitempty"`
+  MergeTx string `json:"merge_tx,omitempty"`
+  FailedPhase string `json:"failed_phase,omitempty"`
+  Code string `json:"code,omitempty"`
+}
+
+// ReadJSON loads the keypairs stored in the file name + ".json", skipping
+// the entries with an invalid secret seed. Encrypted files are decrypted
+// with the passphrase
+func ReadJSON(name string, passphrase string) (Voters, error) {
+  voters, err := ReadVoters(name, passphrase)
+  if err != nil { return nil, err }
+
+  // Create the keypairs slice to append the data
+  var keypairs Voters
+  for _, v := range voters {
+    // Get a keypair from the decoded secret seed
+    kp, err := keypair.Parse(v.Sec)
+    if !logErr(err, "Error parsing keypair from decoded voter:") {
+      // Assert type
+      pointer, ok := kp.(*keypair.Full)
+      if ok {
+        // Append keypair to slice
+        keypairs = append(keypairs, pointer)
+      }
+    }
+  }
+  return keypairs, nil
+}
+
+// ReadVoters loads the entries of the file name + ".json", either a plaintext
+// array of voters or an encrypted keystore (decrypted with the passphrase)
+func ReadVoters(name string, passphrase string) ([]VoterJSON, error) {
+  log.Println("Reading", name, "...")
+  // Read the JSON file
+  data, err := ioutil.ReadFile(name + ".json")
+  if logErr(err, "Error opening " + name + ".json:") { return nil, err }
+
+  // Encrypted files are a JSON object instead of an array
+  trimmed := bytes.TrimSpace(data)
+  if len(trimmed) > 0 && trimmed[0] == '{' {
+    var ks KeystoreJSON
+    err = json.Unmarshal(trimmed, &ks)
+    if logErr(err, "Error decoding keystore:") { return nil, err }
+    data, err = openKeystoreJSON(passphrase, &ks)
+    if logErr(err, "Error decrypting " + name + ".json:") { return nil, err }
+  }
+
+  // Create the voters slice to append the data
+  var voters []VoterJSON
+
+  // Create a JSON decoder and Unmarshall the file
+  dec := json.NewDecoder(bytes.NewReader(data))
+  // Start the array by reading an open bracket ('[')
+  t, err := dec.Token()
+  if logErr(err, "Error getting token '[' from file:") || t != json.Delim('[') {
+    log.Println("Decoding JSON file: Wrong token. Expected '[', got:", t)
+    return nil, errors.New("decoding " + name + ".json: expected '['")
+  }
+  // While the array contain JSON values
+  for dec.More() {
+    // Decode the voter
+    var v VoterJSON
+    err = dec.Decode(&v)
+    if logErr(err, "Error decoding voter:") { return nil, err }
+    voters = append(voters, v)
+  }
+  // Finish the array by reading a closing bracket (']')
+  t, err = dec.Token()
+  if logErr(err, "Error getting token ']' from file:") || t != json.Delim(']') {
+    log.Println("Decoding JSON file: Wrong token. Expected ']', got:", t)
+    return nil, errors.New("decoding " + name + ".json: expected ']'")
+  }
+
+  return voters, nil
+}
+
+// SaveJSON writes pairs to the file name + ".json", replacing it if it
+// already exists. If passphrase is not "", the file is encrypted with it.
+// On errors the data is dumped in the logs
+func SaveJSON(name string, pairs Voters, passphrase string) error {
+  var jsonVoters []VoterJSON
+  for _, p := range pairs {
+    jsonVoters = append(jsonVoters, VoterJSON{
+      Pub: p.Address(),
+      Sec: p.Seed(),
+    })
+  }
+  return SaveVoters(name, jsonVoters, passphrase)
+}
+
+// SaveVoters writes the voters to the file name + ".json" atomically, so the
+// file either has the old or the new voters, even if the process dies.
+// If passphrase is not "", the file is an encrypted keystore
+func SaveVoters(name string, jsonVoters []VoterJSON, passphrase string) error {
+  log.Println("Saving", len(jsonVoters), "keypairs to", name + ".json", "...")
+  // The data as it will be written (encrypted or not)
+  var data interface{} = jsonVoters
+  if passphrase != "" {
+    plaintext, err := json.Marshal(jsonVoters)
+    if logErr(err, "Error encoding JSON:") { return err }
+    k, err := newKeystore(passphrase)
+    if logErr(err, "Error deriving the keystore key:") { return err }
+    data, err = k.sealJSON(plaintext)
+    if logErr(err, "Error encrypting the keypairs:") { return err }
+  }
+
+  err := writeFileAtomic(name + ".json", func(f *os.File) error {
+    // Create a JSON encoder with the file and Marshal the structure
+    enc := json.NewEncoder(f)
+    enc.SetIndent("", " ")
+    err := enc.Encode(data)
+    // In case of errors, try to save the data in Go's format (no JSON)
+    if logErr(err, "Error encoding JSON: ") {
+      log.Println("Trying to save data in Go's format...")
+      _, err = fmt.Fprintf(f, "%#v", data)
+    }
+    return err
+  })
+  // If it still errors, just dump the data (encrypted if possible) in the log
+  logDumpData(err, data, "Error saving data to " + name + ".json:")
+  return err
+}
+
+// Writes to a temporary file in the same directory as path, syncs it to the
+// disk and renames it to path. The file is only readable by its owner
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+  tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path) + ".tmp")
+  if err != nil { return err }
+  // Remove the temporary file, unless it was renamed
+  defer os.Remove(tmp.Name())
+
+  err = write(tmp)
+  if err == nil {
+    err = tmp.Sync()
+  }
+  closeErr := tmp.Close()
+  if err == nil {
+    err = closeErr
+  }
+  if err != nil { return err }
+
+  err = os.Rename(tmp.Name(), path)
+  if err != nil { return err }
+
+  // Sync the directory, so the rename itself is on the disk
+  dir, err := os.Open(filepath.Dir(path))
+  if err != nil { return err }
+  defer dir.Close()
+  return dir.Sync()
+}
@@ -0,0 +1,28 @@
+package pool
+
+import (
+  "log"
+  "net/http"
+  "io/ioutil"
+  "github.com/stellar/go/keypair"
+)
+
+func askFriendBot(url string, p *keypair.Full) bool {
+  resp, err := http.Get(url + p.Address())
+  if logErr(err, "Error funding account with the friendbot:") {
+    return false
+  }
+  defer resp.Body.Close()
+
+  // Maybe the 'if' should test for StatusCode != 200 ?
+  if resp.StatusCode < 200 || resp.StatusCode > 299 {
+    body, err := ioutil.ReadAll(resp.Body)
+    if !logErr(err, "Error reading the body of the friendbot's response:") {
+      log.Println("Status", resp.Status, "funding", p.Address(), "on FriendBot")
+      log.Println(string(body))
+    }
+    return false
+  }
+  // This means the friendbot returned any status code between 200 and 299 (success)
+  return true
+}
@@ -0,0 +1,89 @@
+package pool
+
+import (
+  "errors"
+  "strconv"
+  "net/http"
+  "encoding/json"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Horizon holds the requests made to a Horizon server while creating a pool.
+// It is satisfied by HorizonClient, and can be replaced to run offline
+// (see package horizontest, a fake Horizon server)
+type Horizon interface {
+  SubmitTransaction(txeBase64 string) (horizon.TransactionSuccess, error)
+  SequenceForAccount(accountID string) (xdr.SequenceNumber, error)
+  LoadAccount(accountID string) (horizon.Account, error)
+  // LoadTransaction gets the transaction with the hash (in hex) from the
+  // ledger, returning false if it isn't there
+  LoadTransaction(hash string) (LedgerTransaction, bool, error)
+  // FeeStats gets the fees accepted in the last ledgers, by stat (like
+  // "mode_accepted_fee" or "p90_accepted_fee")
+  FeeStats() (map[string]uint64, error)
+}
+
+// LedgerTransaction is a transaction in the ledger. It isn't Successful if
+// its operations failed, only using the sequence number and the fee
+type LedgerTransaction struct {
+  Hash string `json:"hash"`
+  Ledger int32 `json:"ledger"`
+  Env string `json:"envelope_xdr"`
+  Result string `json:"result_xdr"`
+  Successful bool `json:"successful"`
+}
+
+// HorizonClient is a *horizon.Client with the requests it is missing
+type HorizonClient struct {
+  *horizon.Client
+}
+
+func (c HorizonClient) LoadTransaction(hash string) (LedgerTransaction, bool, error) {
+  var tx struct {
+    LedgerTransaction
+    // Older Horizon versions only list successful transactions
+    Successful *bool `json:"successful"`
+  }
+  found, err := c.get("/transactions/" + hash, &tx)
+  tx.LedgerTransaction.Successful = tx.Successful == nil || *tx.Successful
+  return tx.LedgerTransaction, found, err
+}
+
+func (c HorizonClient) FeeStats() (map[string]uint64, error) {
+  // Horizon sends the values as strings
+  var values map[string]interface{}
+  found, err := c.get("/fee_stats", &values)
+  if err != nil { return nil, err }
+  if !found { return nil, errors.New("no fee stats in Horizon") }
+  stats := make(map[string]uint64)
+  for k, v := range values {
+    switch v := v.(type) {
+    case string:
+      // Skips the values that aren't fees, like the capacity usage
+      if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+        stats[k] = n
+      }
+    case float64:
+      stats[k] = uint64(v)
+    }
+  }
+  return stats, nil
+}
+
+// Gets path from the Horizon server into v. Returns false if the resource
+// doesn't exist
+func (c HorizonClient) get(path string, v interface{}) (bool, error) {
+  var hc horizon.HTTP = http.DefaultClient
+  if c.HTTP != nil {
+    hc = c.HTTP
+  }
+  resp, err := hc.Get(c.URL + path)
+  if err != nil { return false, err }
+  defer resp.Body.Close()
+  if resp.StatusCode == http.StatusNotFound { return false, nil }
+  if resp.StatusCode != http.StatusOK {
+    return false, errors.New(path + ": " + resp.Status)
+  }
+  return true, json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,413 @@
+package pool
+
+import (
+  "os"
+  "log"
+  "sync"
+  "bufio"
+  "errors"
+  "encoding/json"
+  "github.com/stellar/go/keypair"
+)
+
+// States of an account in the Journal
+const (
+  STATE_GENERATED = "generated"
+  STATE_FUNDED = "funded"
+  STATE_INFLATION_SET = "inflation_set"
+  STATE_MERGED = "merged"
+  STATE_FAILED = "failed"
+)
+
+// Phases where an account can fail
+const (
+  PHASE_FUND = "fund"
+  PHASE_INFLATION = "inflation"
+  PHASE_DISSOLVE = "dissolve"
+)
+
+// JournalEntry is the last known state of an account
+type JournalEntry struct {
+  Pub string `json:"pub"`
+  Sec string `json:"sec"`
+  State string `json:"state"`
+  // SEP-0005 derivation index, if derived from a mnemonic
+  Index *int `json:"index,omitempty"`
+  // Hashes of the transactions that funded, set the inflation destination
+  // and merged the account
+  FundTx string `json:"fund_tx,omitempty"`
+  InflationTx string `json:"inflation_tx,omitempty"`
+  MergeTx string `json:"merge_tx,omitempty"`
+  // Phase where the account failed and its result code, if State is STATE_FAILED
+  FailedPhase string `json:"failed_phase,omitempty"`
+  Code string `json:"code,omitempty"`
+}
+
+// Journal keeps the state of every account of a run in a file, writing one
+// JSON line for each change, so an interrupted run can be resumed
+type Journal struct {
+  f *os.File
+  // Encrypts the secret seeds written to the file (nil if not encrypted)
+  ks *keystore
+  mu sync.Mutex
+  entries []*JournalEntry
+  index map[string]*JournalEntry
+}
+
+// NewJournal returns a Journal that is only kept in memory
+func NewJournal() *Journal {
+  return &Journal{
+    index: make(map[string]*JournalEntry),
+  }
+}
+
+// Line of the journal file. The first line of encrypted journals only has
+// the KDF parameters, and the Sec of the entries is encrypted
+type journalLine struct {
+  JournalEntry
+  KDF *KDFParams `json:"kdf,omitempty"`
+}
+
+// OpenAccounts loads the account file name + ".json" into an in-memory
+// Journal, to continue from the state saved in it. Accounts without a
+// status (like the ones in -input files) are considered funded
+func OpenAccounts(name string, passphrase string) (*Journal, error) {
+  voters, err := ReadVoters(name, passphrase)
+  if err != nil { return nil, err }
+  j := NewJournal()
+  for _, v := range voters {
+    state := v.Status
+    if state == "" {
+      state = STATE_FUNDED
+    }
+    j.set(&JournalEntry{
+      Pub: v.Pub,
+      Sec: v.Sec,
+      Index: v.Index,
+      State: state,
+      FundTx: v.FundTx,
+      InflationTx: v.InflationTx,
+      MergeTx: v.MergeTx,
+      FailedPhase: v.FailedPhase,
+      Code: v.Code,
+    })
+  }
+  return j, nil
+}
+
+// OpenJournal opens the journal in the file name + ".jsonl". If resume is
+// false a new journal is started, refusing to replace one with accounts,
+// otherwise its entries are loaded.
+// If passphrase is not "", new journals have their secret seeds encrypted
+func OpenJournal(name string, resume bool, passphrase string) (*Journal, error) {
+  // The journal may have the only copy of the seeds of an interrupted run
+  if info, err := os.Stat(name + ".jsonl"); err == nil && info.Size() > 0 && !resume {
+    return nil, errors.New(name + ".jsonl has the accounts of an earlier run, " +
+      "resume it or remove the file")
+  }
+  j := NewJournal()
+  flags := os.O_CREATE | os.O_RDWR | os.O_APPEND
+  if !resume {
+    flags |= os.O_TRUNC
+  }
+  f, err := os.OpenFile(name + ".jsonl", flags, 0600)
+  if logErr(err, "Error opening " + name + ".jsonl:") { return nil, err }
+  j.f = f
+
+  err = j.load(passphrase)
+  // Resuming with a passphrase would add seeds in clear text to the file
+  if err == nil && j.ks == nil && len(j.entries) > 0 && passphrase != "" {
+    err = errors.New("the journal is not encrypted, resume it without a passphrase")
+  }
+  if logErr(err, "Error reading " + name + ".jsonl:") {
+    f.Close()
+    return nil, err
+  }
+  // Start encrypting empty journals, writing the header line
+  if j.ks == nil && len(j.entries) == 0 && passphrase != "" {
+    j.ks, err = newKeystore(passphrase)
+    if err == nil {
+      err = json.NewEncoder(f).Encode(journalLine{KDF: &j.ks.params})
+    }
+    if logErr(err, "Error starting encrypted journal:") {
+      f.Close()
+      return nil, err
+    }
+  }
+  log.Println("Journal", name + ".jsonl", "has", len(j.entries), "accounts")
+  return j, nil
+}
+
+// Replays the changes in the file, the last line of each account has its
+// current state
+func (j *Journal) load(passphrase string) error {
+  scanner := bufio.NewScanner(j.f)
+  for scanner.Scan() {
+    var line journalLine
+    err := json.Unmarshal(scanner.Bytes(), &line)
+    // A line cut short by a crash is skipped
+    if logErr(err, "Error decoding journal line:") { continue }
+
+    // Header of an encrypted journal
+    if line.KDF != nil {
+      j.ks, err = openKeystore(passphrase, *line.KDF)
+      if err != nil { return err }
+      continue
+    }
+    e := line.JournalEntry
+    if j.ks != nil {
+      e.Sec, err = j.ks.openString(e.Sec)
+      if err != nil { return err }
+    }
+    j.set(&e)
+  }
+  return scanner.Err()
+}
+
+func (j *Journal) Close() error {
+  if j.f == nil { return nil }
+  return j.f.Close()
+}
+
+// Persistent is true if the journal is kept in a file
+func (j *Journal) Persistent() bool {
+  return j != nil && j.f != nil
+}
+
+// Stores the entry in memory (j.mu must be held)
+func (j *Journal) set(e *JournalEntry) {
+  if old, ok := j.index[e.Pub]; ok {
+    *old = *e
+    return
+  }
+  j.entries = append(j.entries, e)
+  j.index[e.Pub] = e
+}
+
+// Applies change to the entries of the addresses, and writes them to the file.
+// Like the other methods that record changes, it does nothing on a nil Journal
+func (j *Journal) update(addresses []string, change func(e *JournalEntry)) error {
+  if j == nil { return nil }
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  // In memory journals only apply the changes
+  if j.f == nil {
+    for _, a := range addresses {
+      if e, ok := j.index[a]; ok {
+        change(e)
+      }
+    }
+    return nil
+  }
+  w := bufio.NewWriter(j.f)
+  enc := json.NewEncoder(w)
+  for _, a := range addresses {
+    e, ok := j.index[a]
+    if !ok { continue }
+    change(e)
+    // Never write the secret seed in clear text to encrypted journals
+    line := journalLine{JournalEntry: *e}
+    if j.ks != nil {
+      var err error
+      line.Sec, err = j.ks.sealString(e.Sec)
+      if logErr(err, "Error encrypting the journal:") { return err }
+    }
+    err := enc.Encode(line)
+    if logErr(err, "Error writing to the journal:") { return err }
+  }
+  err := w.Flush()
+  if logErr(err, "Error writing to the journal:") { return err }
+  err = j.f.Sync()
+  logErr(err, "Error syncing the journal:")
+  return err
+}
+
+// Generated adds the pairs to the journal (pairs already in it are kept as they are)
+func (j *Journal) Generated(pairs Voters) error {
+  return j.add(pairs, -1)
+}
+
+// Derived adds the pairs derived from a mnemonic, the first one with the
+// derivation index first and the others with the following indexes
+func (j *Journal) Derived(pairs Voters, first int) error {
+  return j.add(pairs, first)
+}
+
+// Adds the pairs as generated, with their derivation index if first >= 0
+func (j *Journal) add(pairs Voters, first int) error {
+  if j == nil { return nil }
+  var addresses []string
+  j.mu.Lock()
+  for i, p := range pairs {
+    if _, ok := j.index[p.Address()]; ok { continue }
+    e := &JournalEntry{Pub: p.Address(), Sec: p.Seed(), State: STATE_GENERATED}
+    if first >= 0 {
+      index := first + i
+      e.Index = &index
+    }
+    j.set(e)
+    addresses = append(addresses, p.Address())
+  }
+  j.mu.Unlock()
+  return j.update(addresses, func(e *JournalEntry) {})
+}
+
+// Funded marks the pairs as funded by the transaction hash ("" if unknown)
+func (j *Journal) Funded(pairs Voters, hash string) error {
+  return j.update(pairs.addresses(), func(e *JournalEntry) {
+    e.State = STATE_FUNDED
+    e.FundTx = hash
+    e.FailedPhase = ""
+    e.Code = ""
+  })
+}
+
+// InflationSet marks the pairs as having the inflation destination set by hash
+func (j *Journal) InflationSet(pairs Voters, hash string) error {
+  return j.update(pairs.addresses(), func(e *JournalEntry) {
+    e.State = STATE_INFLATION_SET
+    e.InflationTx = hash
+    e.FailedPhase = ""
+    e.Code = ""
+  })
+}
+
+// Merged marks the pairs as merged by the transaction hash
+func (j *Journal) Merged(pairs Voters, hash string) error {
+  return j.update(pairs.addresses(), func(e *JournalEntry) {
+    e.State = STATE_MERGED
+    e.MergeTx = hash
+    e.FailedPhase = ""
+    e.Code = ""
+  })
+}
+
+// Failed marks the accounts as failed in the phase, with their result codes
+func (j *Journal) Failed(phase string, codes map[string]string) error {
+  var addresses []string
+  for a := range codes {
+    addresses = append(addresses, a)
+  }
+  return j.update(addresses, func(e *JournalEntry) {
+    e.State = STATE_FAILED
+    e.FailedPhase = phase
+    e.Code = codes[e.Pub]
+  })
+}
+
+// Puts the pairs that failed in the phase back in state, forgetting their
+// result codes
+func (j *Journal) clearFailed(pairs Voters, phase string, state string) error {
+  if j == nil { return nil }
+  var addresses []string
+  j.mu.Lock()
+  for _, p := range pairs {
+    if e, ok := j.index[p.Address()]; ok && e.State == STATE_FAILED && e.FailedPhase == phase {
+      addresses = append(addresses, p.Address())
+    }
+  }
+  j.mu.Unlock()
+  return j.update(addresses, func(e *JournalEntry) {
+    e.State = state
+    e.FailedPhase = ""
+    e.Code = ""
+  })
+}
+
+// Entries returns a copy of every entry, in the order they were added
+func (j *Journal) Entries() []JournalEntry {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  entries := make([]JournalEntry, len(j.entries))
+  for i, e := range j.entries {
+    entries[i] = *e
+  }
+  return entries
+}
+
+// Pending splits the accounts in the ones that still have to be funded, the
+// ones that still need the inflation destination and the ones already done.
+// Accounts that failed are retried from the phase where they failed, except
+// the ones that failed to be merged, which are in none of them (the pool is
+// being dissolved, and Existing has them, so dissolving again retries them)
+func (j *Journal) Pending() (toFund Voters, toSet Voters, done Voters) {
+  for _, e := range j.Entries() {
+    kp, err := keypair.Parse(e.Sec)
+    if logErr(err, "Error parsing keypair from the journal:") { continue }
+    p, ok := kp.(*keypair.Full)
+    if !ok { continue }
+
+    switch {
+    case e.State == STATE_GENERATED:
+      toFund = append(toFund, p)
+    case e.State == STATE_FAILED && e.FailedPhase == PHASE_FUND:
+      toFund = append(toFund, p)
+    case e.State == STATE_FUNDED:
+      toSet = append(toSet, p)
+    case e.State == STATE_FAILED && e.FailedPhase == PHASE_INFLATION:
+      toSet = append(toSet, p)
+    case e.State == STATE_INFLATION_SET:
+      done = append(done, p)
+    }
+  }
+  return toFund, toSet, done
+}
+
+// Returns the pairs whose accounts are in the state, in the same order
+func (j *Journal) only(pairs Voters, state string) Voters {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  var tmp Voters
+  for _, p := range pairs {
+    if e, ok := j.index[p.Address()]; ok && e.State == state {
+      tmp = append(tmp, p)
+    }
+  }
+  return tmp
+}
+
+// Existing returns the accounts that were funded and not merged yet, the
+// ones that should exist on the network (including the ones that failed to
+// be merged)
+func (j *Journal) Existing() Voters {
+  var pairs Voters
+  for _, e := range j.Entries() {
+    funded := e.State == STATE_FUNDED || e.State == STATE_INFLATION_SET ||
+      e.State == STATE_FAILED && e.FailedPhase != PHASE_FUND
+    if !funded { continue }
+    kp, err := keypair.Parse(e.Sec)
+    if logErr(err, "Error parsing keypair from the journal:") { continue }
+    if p, ok := kp.(*keypair.Full); ok {
+      pairs = append(pairs, p)
+    }
+  }
+  return pairs
+}
+
+// Voters returns every account annotated with its state, to be saved
+func (j *Journal) Voters() []VoterJSON {
+  var voters []VoterJSON
+  for _, e := range j.Entries() {
+    voters = append(voters, VoterJSON{
+      Pub: e.Pub,
+      Sec: e.Sec,
+      Index: e.Index,
+      Status: e.State,
+      FundTx: e.FundTx,
+      InflationTx: e.InflationTx,
+      MergeTx: e.MergeTx,
+      FailedPhase: e.FailedPhase,
+      Code: e.Code,
+    })
+  }
+  return voters
+}
+
+// Addresses of the pairs, in the same order
+func (pairs Voters) addresses() []string {
+  addresses := make([]string, len(pairs))
+  for i, p := range pairs {
+    addresses[i] = p.Address()
+  }
+  return addresses
+}
@@ -0,0 +1,141 @@
+package pool
+
+import (
+  "errors"
+  "crypto/aes"
+  "crypto/rand"
+  "crypto/cipher"
+  "encoding/base64"
+  "golang.org/x/crypto/scrypt"
+)
+
+// Parameters used to derive new keys with scrypt
+const SCRYPT_N = 32768
+const SCRYPT_R = 8
+const SCRYPT_P = 1
+const KEY_LENGTH = 32
+// Largest parameters accepted from a file (scrypt uses 128*N*r bytes of
+// memory, 1 GiB at the limits, and p times that in time)
+const SCRYPT_N_MAX = 1 << 20
+const SCRYPT_R_MAX = 8
+const SCRYPT_P_MAX = 16
+
+// KDFParams are the scrypt parameters used to derive a key from a passphrase
+type KDFParams struct {
+  Name string `json:"name"`
+  N int `json:"n"`
+  R int `json:"r"`
+  P int `json:"p"`
+  Salt string `json:"salt"`
+}
+
+// KeystoreJSON is the format of encrypted account files. Ciphertext has the
+// same JSON array of a plaintext file, encrypted with AES-256-GCM
+type KeystoreJSON struct {
+  Version int `json:"version"`
+  KDF KDFParams `json:"kdf"`
+  Cipher string `json:"cipher"`
+  Nonce string `json:"nonce"`
+  Ciphertext string `json:"ciphertext"`
+}
+
+// Encrypts and decrypts with a key derived from a passphrase
+type keystore struct {
+  params KDFParams
+  aead cipher.AEAD
+}
+
+// Derives a key from the passphrase with a new random salt
+func newKeystore(passphrase string) (*keystore, error) {
+  salt := make([]byte, 32)
+  _, err := rand.Read(salt)
+  if err != nil { return nil, err }
+  return openKeystore(passphrase, KDFParams{
+    Name: "scrypt",
+    N: SCRYPT_N,
+    R: SCRYPT_R,
+    P: SCRYPT_P,
+    Salt: base64.StdEncoding.EncodeToString(salt),
+  })
+}
+
+// Derives the key from the passphrase with existing parameters
+func openKeystore(passphrase string, params KDFParams) (*keystore, error) {
+  if passphrase == "" { return nil, errors.New("missing passphrase") }
+  if params.Name != "scrypt" { return nil, errors.New("unknown KDF " + params.Name) }
+  // The parameters come from the file, never spend unbounded memory on them
+  if params.N < 2 || params.N > SCRYPT_N_MAX || params.R < 1 || params.R > SCRYPT_R_MAX ||
+    params.P < 1 || params.P > SCRYPT_P_MAX {
+    return nil, errors.New("unsupported scrypt parameters")
+  }
+  salt, err := base64.StdEncoding.DecodeString(params.Salt)
+  if err != nil { return nil, err }
+
+  key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, KEY_LENGTH)
+  if err != nil { return nil, err }
+  block, err := aes.NewCipher(key)
+  if err != nil { return nil, err }
+  aead, err := cipher.NewGCM(block)
+  if err != nil { return nil, err }
+  return &keystore{params: params, aead: aead}, nil
+}
+
+// Encrypts plaintext with a new random nonce
+func (k *keystore) seal(plaintext []byte) (nonce []byte, ciphertext []byte, err error) {
+  nonce = make([]byte, k.aead.NonceSize())
+  _, err = rand.Read(nonce)
+  if err != nil { return nil, nil, err }
+  return nonce, k.aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// Decrypts and authenticates the ciphertext
+func (k *keystore) open(nonce []byte, ciphertext []byte) ([]byte, error) {
+  if len(nonce) != k.aead.NonceSize() { return nil, errors.New("invalid nonce") }
+  plaintext, err := k.aead.Open(nil, nonce, ciphertext, nil)
+  if err != nil { return nil, errors.New("wrong passphrase or corrupted data") }
+  return plaintext, nil
+}
+
+// Encrypts a whole account file
+func (k *keystore) sealJSON(plaintext []byte) (*KeystoreJSON, error) {
+  nonce, ciphertext, err := k.seal(plaintext)
+  if err != nil { return nil, err }
+  return &KeystoreJSON{
+    Version: 1,
+    KDF: k.params,
+    Cipher: "aes-256-gcm",
+    Nonce: base64.StdEncoding.EncodeToString(nonce),
+    Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+  }, nil
+}
+
+// Decrypts an account file, returning the plaintext JSON array
+func openKeystoreJSON(passphrase string, ks *KeystoreJSON) ([]byte, error) {
+  if ks.Version != 1 || ks.Cipher != "aes-256-gcm" {
+    return nil, errors.New("unsupported keystore format")
+  }
+  k, err := openKeystore(passphrase, ks.KDF)
+  if err != nil { return nil, err }
+  nonce, err := base64.StdEncoding.DecodeString(ks.Nonce)
+  if err != nil { return nil, err }
+  ciphertext, err := base64.StdEncoding.DecodeString(ks.Ciphertext)
+  if err != nil { return nil, err }
+  return k.open(nonce, ciphertext)
+}
+
+// Encrypts a secret seed to be stored in a single string
+func (k *keystore) sealString(s string) (string, error) {
+  nonce, ciphertext, err := k.seal([]byte(s))
+  if err != nil { return "", err }
+  return base64.StdEncoding.EncodeToString(append(nonce, ciphertext...)), nil
+}
+
+// Decrypts a string encrypted by sealString
+func (k *keystore) openString(s string) (string, error) {
+  data, err := base64.StdEncoding.DecodeString(s)
+  if err != nil { return "", err }
+  n := k.aead.NonceSize()
+  if len(data) < n { return "", errors.New("invalid encrypted string") }
+  plaintext, err := k.open(data[:n], data[n:])
+  return string(plaintext), err
+}
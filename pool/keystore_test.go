@@ -0,0 +1,27 @@
+package pool
+
+import (
+  "testing"
+)
+
+func TestKeystoreJSON(t *testing.T) {
+  k, err := newKeystore("passphrase")
+  if err != nil { t.Fatal(err) }
+  ks, err := k.sealJSON([]byte("[]"))
+  if err != nil { t.Fatal(err) }
+
+  plaintext, err := openKeystoreJSON("passphrase", ks)
+  if err != nil { t.Fatal(err) }
+  if string(plaintext) != "[]" {
+    t.Errorf("decrypted %q, expected []", plaintext)
+  }
+  if _, err = openKeystoreJSON("wrong", ks); err == nil {
+    t.Error("decrypted with the wrong passphrase")
+  }
+
+  // A file asking for 128 GiB of memory is refused before deriving the key
+  ks.KDF.N = 1 << 30
+  if _, err = openKeystoreJSON("passphrase", ks); err == nil {
+    t.Error("accepted unbounded scrypt parameters")
+  }
+}
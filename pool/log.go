@@ -0,0 +1,23 @@
+package pool
+
+import (
+  "log"
+)
+
+func logErr(err error, message string) bool {
+  if err != nil {
+    log.Println(message, err)
+    return true
+  } else {
+    return false
+  }
+}
+
+func logDumpData(err error, data interface{}, message string) bool {
+  if logErr(err, message) {
+    log.Printf("## DATA DUMP ##\n%#v\n", data)
+    return true
+  } else {
+    return false
+  }
+}
@@ -0,0 +1,101 @@
+package pool
+
+import (
+  "errors"
+  "strconv"
+  "strings"
+  "encoding/hex"
+  "crypto/sha256"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+)
+
+// Types of memo
+const (
+  MEMO_NONE = "none"
+  MEMO_TEXT = "text"
+  MEMO_ID = "id"
+  MEMO_HASH = "hash"
+)
+
+// Longest text memo, in bytes
+const MEMO_TEXT_MAX = 28
+
+// Default memo templates of each kind of transaction
+const (
+  FUND_MEMO = "{dest} funding accounts"
+  INFLATION_MEMO = "Voting for {dest}"
+  MERGE_MEMO = "Merging into {dest}"
+)
+
+// Memo builds the memo of each transaction from a template, where these
+// placeholders are replaced:
+//  {batch}: index of the batch of operations in its phase, from 0
+//  {run}: RunID
+//  {pool}: Pool
+//  {dest}: last 8 characters of the funder, inflation destination or merge
+//  destination, depending on the transaction
+type Memo struct {
+  // MEMO_TEXT (default), MEMO_ID (the result must be a number), MEMO_HASH
+  // (the result is hashed with SHA-256, unless it is 64 hex characters) or
+  // MEMO_NONE
+  Type string
+  // Template of the memo ("" for the default of the transaction)
+  Template string
+  RunID string
+  Pool string
+}
+
+// Checks the type of the memo
+func (m Memo) validate() error {
+  switch m.Type {
+  case "", MEMO_NONE, MEMO_TEXT, MEMO_ID, MEMO_HASH:
+    return nil
+  }
+  return errors.New("unknown memo type " + m.Type)
+}
+
+// Builds the memo of the batch from the template (or def if there is none)
+func (m Memo) mutator(def string, batch int, dest string) (build.TransactionMutator, error) {
+  template := m.Template
+  if template == "" {
+    template = def
+  }
+  if len(dest) > 8 {
+    dest = dest[len(dest)-8:]
+  }
+  value := strings.NewReplacer(
+    "{batch}", strconv.Itoa(batch),
+    "{run}", m.RunID,
+    "{pool}", m.Pool,
+    "{dest}", dest,
+  ).Replace(template)
+
+  switch m.Type {
+  case "", MEMO_TEXT:
+    if len(value) > MEMO_TEXT_MAX {
+      return nil, errors.New("the memo \"" + value + "\" is longer than 28 bytes")
+    }
+    return build.MemoText{ value }, nil
+  case MEMO_ID:
+    id, err := strconv.ParseUint(value, 10, 64)
+    if err != nil { return nil, errors.New("the memo \"" + value + "\" is not an ID") }
+    return build.MemoID{ id }, nil
+  case MEMO_HASH:
+    var hash xdr.Hash
+    if raw, err := hex.DecodeString(value); err == nil && len(raw) == len(hash) {
+      copy(hash[:], raw)
+    } else {
+      hash = sha256.Sum256([]byte(value))
+    }
+    return build.MemoHash{ hash }, nil
+  }
+  return noMemo{}, nil
+}
+
+// Leaves the transaction without a memo
+type noMemo struct{}
+
+func (m noMemo) MutateTransaction(o *build.TransactionBuilder) error {
+  return nil
+}
@@ -0,0 +1,57 @@
+package pool
+
+import (
+  "testing"
+  "context"
+)
+
+func TestValidateMemos(t *testing.T) {
+  valid := Config{InflationMemo: "Pool {pool} batch {batch}", PoolName: "long-pool-name"}
+  if err := valid.Validate(); err != nil {
+    t.Errorf("refused a valid memo: %v", err)
+  }
+
+  invalid := []Config{
+    // The default templates are text
+    {MemoType: MEMO_ID},
+    {MemoType: MEMO_ID, FundMemo: "{batch}", InflationMemo: "{batch}"},
+    {MemoType: "unknown"},
+  }
+  for _, cfg := range invalid {
+    if err := cfg.Validate(); err == nil {
+      t.Errorf("accepted the memos of %+v", cfg)
+    }
+  }
+}
+
+func TestCheckMemoLastBatch(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  pairs, err := Generate(10 * SIGNERS_PER_TX_MAX + 1)
+  if err != nil { t.Fatal(err) }
+
+  // 28 bytes in the last batch (10)
+  cfg.InflationMemo = "Pool {pool} batch {batch}"
+  cfg.PoolName = "long-pool-name"
+  if err = cfg.checkMemo(cfg.InflationMemo, INFLATION_MEMO, "", len(pairs), SIGNERS_PER_TX_MAX); err != nil {
+    t.Errorf("refused a memo of 28 bytes: %v", err)
+  }
+  // 29 bytes only in the last batch
+  cfg.PoolName = "long-pool-names"
+  if _, err = SetInflation(context.Background(), cfg, cfg.Horizon, pairs); err == nil {
+    t.Error("accepted an inflation memo of 29 bytes in the last batch")
+  }
+
+  // The funding memo is checked before sending anything (5 pairs per
+  // transaction, 40 batches)
+  cfg.FundMemo = "Funding {pool} batch {batch}"
+  cfg.PoolName = "long-pool-na"
+  before, _ := srv.Account(funder.Address())
+  if _, err = Fund(context.Background(), cfg, cfg.Horizon, pairs); err == nil {
+    t.Error("accepted a fund memo of 29 bytes in the last batch")
+  }
+  after, _ := srv.Account(funder.Address())
+  if after.Sequence != before.Sequence {
+    t.Error("sent transactions before checking the memo")
+  }
+}
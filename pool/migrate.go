@@ -0,0 +1,145 @@
+package pool
+
+import (
+  "errors"
+  "context"
+)
+
+// Codes of the accounts not migrated, besides the result codes of the
+// operations that failed
+const (
+  // The account votes for another destination, so it is left as it is
+  MIGRATE_OTHER_DEST = "other_destination"
+  MIGRATE_NOT_FOUND = "not_found"
+  MIGRATE_LOAD_ERROR = "load_error"
+  MIGRATE_NOT_SET = "not_set"
+)
+
+// MigratedAccount is the inflation destination of an account before and
+// after Migrate
+type MigratedAccount struct {
+  Pub string `json:"pub"`
+  Before string `json:"before"`
+  // Loaded again after migrating it ("" if that failed)
+  After string `json:"after"`
+  Migrated bool `json:"migrated"`
+  // Why it wasn't migrated
+  Code string `json:"code,omitempty"`
+}
+
+// MigrateReport has every account checked by Migrate and how many are in
+// each case
+type MigrateReport struct {
+  From string `json:"from"`
+  To string `json:"to"`
+  Total int `json:"total"`
+  Migrated int `json:"migrated"`
+  // Accounts voting for other destinations
+  Skipped int `json:"skipped"`
+  Failed int `json:"failed"`
+  Accounts []MigratedAccount `json:"accounts"`
+}
+
+// Migrate moves the accounts of pairs whose inflation destination is
+// cfg.MigrateFrom to cfg.InflationDest, which must exist. The accounts are
+// loaded first (like in Verify), and only the ones voting for MigrateFrom
+// are set (like in SetInflation). The report is in the same order as pairs
+func Migrate(ctx context.Context, cfg Config, client Horizon, pairs Voters) (*MigrateReport, error) {
+  err := cfg.Validate()
+  if err != nil { return nil, err }
+  if cfg.MigrateFrom == "" {
+    return nil, errors.New("provide the inflation destination to migrate from")
+  }
+  if cfg.MigrateFrom == cfg.InflationDest {
+    return nil, errors.New("the accounts already vote for " + cfg.InflationDest)
+  }
+
+  // Voting for a missing account would fail every operation
+  dest := checkAccount(client, cfg.InflationDest, "")
+  if dest.Error != "" { return nil, errors.New(dest.Error) }
+  if !dest.Exists {
+    return nil, errors.New("the new inflation destination " + cfg.InflationDest + " doesn't exist")
+  }
+
+  // Check which accounts vote for MigrateFrom
+  from := cfg
+  from.InflationDest = cfg.MigrateFrom
+  before, err := Verify(ctx, from, client, pairs.addresses())
+  if err != nil { return nil, err }
+
+  report := &MigrateReport{
+    From: cfg.MigrateFrom,
+    To: cfg.InflationDest,
+    Total: len(pairs),
+    Accounts: make([]MigratedAccount, len(pairs)),
+  }
+  var toSet Voters
+  for i, c := range before.Accounts {
+    a := MigratedAccount{Pub: c.Pub, Before: c.InflationDest, After: c.InflationDest}
+    switch {
+    case c.Error != "":
+      a.Code = MIGRATE_LOAD_ERROR
+    case !c.Exists:
+      a.Code = MIGRATE_NOT_FOUND
+    case !c.OK:
+      a.Code = MIGRATE_OTHER_DEST
+    default:
+      toSet = append(toSet, pairs[i])
+    }
+    report.Accounts[i] = a
+  }
+
+  // They vote for MigrateFrom, so failures of earlier runs are stale, and
+  // only the codes of this run are left in the journal
+  cfg.Journal.clearFailed(toSet, PHASE_INFLATION, STATE_INFLATION_SET)
+  // Re-point them, recording the results in the journal (SetInflation
+  // checks the memo of its last batch before sending anything)
+  set, err := SetInflation(ctx, cfg, client, toSet)
+  migrated := make(map[string]bool)
+  for _, p := range set {
+    migrated[p.Address()] = true
+  }
+  // The result codes of the ones that failed are in the journal
+  codes := make(map[string]string)
+  if cfg.Journal != nil {
+    for _, e := range cfg.Journal.Entries() {
+      if e.State == STATE_FAILED && e.FailedPhase == PHASE_INFLATION {
+        codes[e.Pub] = e.Code
+      }
+    }
+  }
+  // The destination they ended up with, as seen by the network
+  after := make(map[string]AccountCheck)
+  if len(toSet) > 0 {
+    res, err := Verify(ctx, cfg, client, toSet.addresses())
+    if err != nil { return nil, err }
+    for _, c := range res.Accounts {
+      after[c.Pub] = c
+    }
+  }
+
+  for i, c := range before.Accounts {
+    a := &report.Accounts[i]
+    if a.Code == "" {
+      a.After = ""
+      if now, ok := after[c.Pub]; ok && now.Error == "" {
+        a.After = now.InflationDest
+      }
+    }
+    switch {
+    case migrated[c.Pub]:
+      a.Migrated = true
+      report.Migrated++
+    case a.Code == MIGRATE_OTHER_DEST:
+      report.Skipped++
+    case a.Code == "":
+      // Voted for MigrateFrom, but wasn't set
+      a.Code = codes[c.Pub]
+      if a.Code == "" { a.Code = MIGRATE_NOT_SET }
+      report.Failed++
+    default:
+      report.Failed++
+    }
+  }
+  return report, err
+}
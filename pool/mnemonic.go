@@ -0,0 +1,48 @@
+package pool
+
+import (
+  "errors"
+  "github.com/tyler-smith/go-bip39"
+  "github.com/stellar/go/keypair"
+  "github.com/stellar/go/exp/crypto/derivation"
+)
+
+// Size of the entropy of new mnemonics (24 words)
+const MNEMONIC_ENTROPY_BITS = 256
+
+// NewMnemonic creates a random BIP-39 mnemonic to derive the accounts from
+func NewMnemonic() (string, error) {
+  entropy, err := bip39.NewEntropy(MNEMONIC_ENTROPY_BITS)
+  if logErr(err, "Error creating entropy for the mnemonic:") { return "", err }
+  return bip39.NewMnemonic(entropy)
+}
+
+// Derive creates num keypairs from the mnemonic (and its optional password),
+// using the SEP-0005 paths m/44'/148'/i' starting with i = first
+func Derive(mnemonic string, password string, first int, num int) (Voters, error) {
+  if first < 0 || uint64(first) + uint64(num) > uint64(derivation.FirstHardenedIndex) {
+    return nil, errors.New("invalid derivation index")
+  }
+  seed, err := bip39.NewSeedWithErrorChecking(mnemonic, password)
+  if logErr(err, "Error reading the mnemonic:") { return nil, err }
+  // Every account is a child of the same key, derive it only once
+  parent, err := derivation.DeriveForPath(derivation.StellarAccountPrefix, seed)
+  if logErr(err, "Error deriving the accounts key:") { return nil, err }
+
+  pairs := make(Voters, num)
+  for i := range pairs {
+    key, err := parent.Derive(derivation.FirstHardenedIndex + uint32(first + i))
+    if logErr(err, "Error deriving keypair:") { return nil, err }
+    var raw [32]byte
+    copy(raw[:], key.Key)
+    p, err := keypair.FromRawSeed(raw)
+    if logErr(err, "Error creating keypair from derived key:") { return nil, err }
+    pairs[i] = p
+  }
+  return pairs, nil
+}
+
+// Checks the words and checksum of the mnemonic
+func validMnemonic(mnemonic string) bool {
+  return bip39.IsMnemonicValid(mnemonic)
+}
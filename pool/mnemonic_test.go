@@ -0,0 +1,33 @@
+package pool
+
+import (
+  "testing"
+)
+
+// Test 1 of SEP-0005, the accounts m/44'/148'/0' and m/44'/148'/1'
+const SEP5_MNEMONIC = "illness spike retreat truth genius clock brain pass fit cave bargain toe"
+var sep5Accounts = []struct{ pub, sec string }{
+  {"GDRXE2BQUC3AZNPVFSCEZ76NJ3WWL25FYFK6RGZGIEKWE4SOOHSUJUJ6", "SBGWSG6BTNCKCOB3DIFBGCVMUPQFYPA2G4O34RMTB343OYPXU5DJDVMN"},
+  {"GBAW5XGWORWVFE2XTJYDTLDHXTY2Q2MO73HYCGB3XMFMQ562Q2W2GJQX", "SCEPFFWGAG5P2VX5DHIYK3XEMZYLTYWIPWYEKXFHSK25RVMIUNJ7CTIS"},
+}
+
+func TestDerive(t *testing.T) {
+  pairs, err := Derive(SEP5_MNEMONIC, "", 0, len(sep5Accounts))
+  if err != nil { t.Fatal(err) }
+  for i, a := range sep5Accounts {
+    if pairs[i].Address() != a.pub || pairs[i].Seed() != a.sec {
+      t.Errorf("account %d is %s, expected %s", i, pairs[i].Address(), a.pub)
+    }
+  }
+
+  // Starting at another index derives the same accounts
+  pairs, err = Derive(SEP5_MNEMONIC, "", 1, 1)
+  if err != nil { t.Fatal(err) }
+  if pairs[0].Address() != sep5Accounts[1].pub {
+    t.Errorf("account 1 is %s, expected %s", pairs[0].Address(), sep5Accounts[1].pub)
+  }
+
+  // The checksum of the last word is checked
+  _, err = Derive("illness spike retreat truth genius clock brain pass fit cave bargain bargain", "", 0, 1)
+  if err == nil { t.Error("derived from a mnemonic with a wrong checksum") }
+}
@@ -0,0 +1,84 @@
+package pool
+
+import (
+  "fmt"
+  "sort"
+  "errors"
+)
+
+// Signers of the funder: FunderSec (if set) and FunderSigners
+func (cfg *Config) signers() ([]Signer, error) {
+  var signers []Signer
+  if cfg.FunderSec != "" {
+    s, err := SeedSigner(cfg.FunderSec)
+    if err != nil { return nil, err }
+    signers = append(signers, s)
+  }
+  return append(signers, cfg.FunderSigners...), nil
+}
+
+// Picks the funder signers needed to reach the medium threshold of its
+// account (the one of CreateAccount), loading its signers and thresholds
+// from Horizon. Refuses to fund if the signers can't reach it, since the
+// transactions would fail with tx_bad_auth. Signers beyond the threshold are
+// left out, since extra signatures fail with tx_bad_auth_extra
+func funderSigners(client Horizon, cfg Config) ([]Signer, error) {
+  available, err := cfg.signers()
+  if err != nil { return nil, err }
+  acc, err := client.LoadAccount(cfg.FunderPub)
+  if logErr(err, "Error loading the funder account from Horizon:") { return nil, err }
+
+  weights := make(map[string]int32)
+  for _, s := range acc.Signers {
+    key := s.Key
+    if key == "" {
+      key = s.PublicKey
+    }
+    weights[key] = s.Weight
+  }
+  // Use the heaviest signers first, each key only once
+  var signers []Signer
+  seen := make(map[string]bool)
+  for _, s := range available {
+    if seen[s.Address()] { continue }
+    seen[s.Address()] = true
+    if weights[s.Address()] <= 0 {
+      return nil, errors.New(s.Address() + " is not a signer of the funder " + cfg.FunderPub)
+    }
+    signers = append(signers, s)
+  }
+  sort.SliceStable(signers, func(i, j int) bool {
+    return weights[signers[i].Address()] > weights[signers[j].Address()]
+  })
+
+  required := int32(acc.Thresholds.MedThreshold)
+  if required < 1 {
+    required = 1
+  }
+  weight := int32(0)
+  for i, s := range signers {
+    weight += weights[s.Address()]
+    if weight >= required {
+      return signers[:i+1], nil
+    }
+  }
+  return nil, errors.New(fmt.Sprintf("the signers of the funder have weight %d, " +
+    "below its medium threshold %d", weight, required))
+}
+
+// Signers of cfg.FeePayer (none if the voters pay the fees)
+func feePayerSigners(client Horizon, cfg Config) ([]Signer, error) {
+  if cfg.FeePayer == "" { return nil, nil }
+  if cfg.FeePayer == cfg.FunderPub {
+    return funderSigners(client, cfg)
+  }
+  if cfg.FeePayerSec == "" {
+    return nil, errors.New("provide the secret key of the fee payer")
+  }
+  s, err := SeedSigner(cfg.FeePayerSec)
+  if err != nil { return nil, err }
+  if s.Address() != cfg.FeePayer {
+    return nil, errors.New("the secret key is not of the fee payer " + cfg.FeePayer)
+  }
+  return []Signer{s}, nil
+}
@@ -0,0 +1,403 @@
+// Package pool generates Stellar keypairs, funds them and sets their
+// inflation destination, so they can be used as the voters of a pool
+package pool
+
+import (
+  "os"
+  "log"
+  "math"
+  "sync"
+  "time"
+  "errors"
+  "context"
+  "math/rand"
+  "github.com/stellar/go/keypair"
+)
+
+const WG_MAX = 25
+const OPS_PER_TX_MAX = 100
+const SIGNERS_PER_TX_MAX = 20
+const BAD_SEQ_RETRIES_MAX = 3
+const TIMEOUT_WAIT_SECONDS = 5
+const TESTNET_FRIENDBOT_URL = "https://friendbot.stellar.org/?addr="
+
+type Voters []*keypair.Full
+
+// Result holds the keypairs that made it through each phase of a Run
+type Result struct {
+  Generated Voters
+  Funded Voters
+  Inflated Voters
+}
+
+// Pseudo-random generator of the package, so importing it doesn't seed the
+// global one of math/rand
+var rnd = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// Source safe for concurrent use, like the one of the global generator
+type lockedSource struct {
+  mu sync.Mutex
+  src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.src.Seed(seed)
+}
+
+// Run generates cfg.NumAccounts keypairs, funds them, appends the accounts
+// read from cfg.InputFile and sets the inflation destination of all of them.
+// With cfg.Resume, the pending accounts of cfg.Journal are used instead.
+// The keypairs are saved to cfg.OutputFile before any account is funded
+// (never replacing another run's, unless cfg.Overwrite), and saved again
+// before returning, annotated with the result of each one
+func Run(ctx context.Context, cfg Config) (res *Result, err error) {
+  // Complete the report with the error and the state of the accounts when
+  // returning, even if the run never starts
+  defer func() { cfg.Report.Finish(cfg.Journal, err) }()
+  err = cfg.Validate()
+  if err != nil { return nil, err }
+  // The output file may have the only copy of the seeds of an earlier run
+  // (resumed runs save the same accounts again)
+  if cfg.OutputFile != "" && cfg.DryRun == nil && !cfg.Resume && !cfg.Overwrite {
+    if _, err := os.Stat(cfg.OutputFile + ".json"); err == nil {
+      return nil, errors.New(cfg.OutputFile + ".json already exists, set Overwrite to replace it")
+    }
+  }
+  if !cfg.OnlyGenerate {
+    err = cfg.validateFunder()
+    if err != nil { return nil, err }
+  }
+  client := cfg.Client()
+  res = &Result{}
+  // Keep track of every account, even without a journal file
+  if cfg.Journal == nil {
+    cfg.Journal = NewJournal()
+  }
+
+  var pairs, toSet, done Voters
+  if cfg.Resume {
+    // Continue from the state recorded in the journal
+    pairs, toSet, done = cfg.Journal.Pending()
+    log.Println("Resuming:", len(pairs), "to fund,", len(toSet), "to set,", len(done), "done")
+  } else {
+    // Create the Public-Secret keypairs (random or derived)
+    pairs, err = GenerateVoters(ctx, cfg, cfg.Journal)
+    if err != nil { return nil, err }
+    res.Generated = pairs
+  }
+
+  // Never send funds to accounts whose secret seeds could be lost. Dry runs
+  // send nothing, and never replace a file that may have funded seeds
+  if cfg.OutputFile != "" && cfg.DryRun == nil {
+    err = SaveVoters(cfg.OutputFile, cfg.Journal.Voters(), cfg.Passphrase)
+    if err != nil { return res, err }
+    // Save again with the results when returning
+    defer func() { SaveVoters(cfg.OutputFile, cfg.Journal.Voters(), cfg.Passphrase) }()
+  } else if len(pairs) > 0 && !cfg.OnlyGenerate && cfg.DryRun == nil && !cfg.Journal.Persistent() {
+    return res, errors.New("the keypairs must be saved before funding them, " +
+      "set OutputFile or a Journal")
+  }
+  // Stop here if we want only to generate random accounts
+  if cfg.OnlyGenerate {
+    return res, nil
+  }
+
+  // Fund all the accounts
+  pairs, err = Fund(ctx, cfg, client, pairs)
+  res.Funded = pairs
+  if err != nil { return res, err }
+  if cfg.Combined {
+    // Most of them had the inflation destination set while being funded
+    res.Inflated = cfg.Journal.only(pairs, STATE_INFLATION_SET)
+    pairs = cfg.Journal.only(pairs, STATE_FUNDED)
+  }
+  pairs = append(toSet, pairs...)
+
+  // Read extra (funded) addresses from a file, only if its name is not ""
+  if cfg.InputFile != "" && !cfg.Resume {
+    inputPairs, err := ReadJSON(cfg.InputFile, cfg.Passphrase)
+    if err == nil {
+      pairs = append(pairs, inputPairs...)
+      // Record them as funded, since they already exist
+      cfg.Journal.Generated(inputPairs)
+      cfg.Journal.Funded(inputPairs, "")
+    }
+  }
+
+  // Set the inflation destination of every account
+  pairs, err = SetInflation(ctx, cfg, client, pairs)
+  res.Inflated = append(res.Inflated, pairs...)
+  return res, err
+}
+
+// Generate creates num random keypairs
+func Generate(num int) (Voters, error) {
+  pairs := make(Voters, num)
+  for i := range pairs {
+    p, err := keypair.Random()
+    if logErr(err, "Error creating random keypair:") { return nil, err }
+    pairs[i] = p
+  }
+  return pairs, nil
+}
+
+// GenerateVoters creates cfg.NumAccounts keypairs, derived from cfg.Mnemonic
+// if set or random otherwise (matching cfg.Vanity), and adds them to the journal
+func GenerateVoters(ctx context.Context, cfg Config, j *Journal) (Voters, error) {
+  if cfg.Vanity.Enabled() {
+    pairs, err := GenerateVanity(ctx, cfg.Vanity, cfg.NumAccounts)
+    if err != nil { return nil, err }
+    return pairs, j.Generated(pairs)
+  }
+  if cfg.Mnemonic == "" {
+    pairs, err := Generate(cfg.NumAccounts)
+    if err != nil { return nil, err }
+    return pairs, j.Generated(pairs)
+  }
+  pairs, err := Derive(cfg.Mnemonic, cfg.MnemonicPassword, cfg.FirstIndex, cfg.NumAccounts)
+  if err != nil { return nil, err }
+  return pairs, j.Derived(pairs, cfg.FirstIndex)
+}
+
+// Fund creates the accounts of pairs on the network, either with the
+// friendbot (cfg.UseSink on testnet) or with the funder's balance, also
+// setting their inflation destination if cfg.Combined (not with the friendbot).
+// Returns the keypairs successfully funded
+func Fund(ctx context.Context, cfg Config, client Horizon, pairs Voters) (Voters, error) {
+  err := cfg.Validate()
+  if err != nil { return nil, err }
+  err = cfg.validateFunder()
+  if err != nil { return nil, err }
+
+  if !cfg.Livenet && cfg.UseSink {
+    // The friendbot doesn't take transactions, assume it funds every account
+    if cfg.DryRun != nil {
+      for _, p := range pairs {
+        cfg.DryRun.created(p.Address())
+      }
+      return pairs, nil
+    }
+    funded, err := fundWithFriendBot(ctx, cfg.FriendbotURL, pairs)
+    // Record which accounts the friendbot funded
+    failed := make(map[string]string)
+    for _, p := range pairs {
+      failed[p.Address()] = "friendbot_error"
+    }
+    for _, p := range funded {
+      delete(failed, p.Address())
+    }
+    cfg.Journal.Funded(funded, "")
+    cfg.Journal.Failed(PHASE_FUND, failed)
+    return funded, err
+  }
+
+  // Pick the balances of every account at once, so totals are exact
+  amounts, err := cfg.amounts(pairs)
+  if err != nil { return nil, err }
+  // Make sure the funder's signatures are enough before sending anything
+  signers, err := funderSigners(client, cfg)
+  if err != nil { return nil, err }
+  size, err := cfg.fundBatchSize(signers)
+  if err != nil { return nil, err }
+  err = cfg.checkMemo(cfg.FundMemo, FUND_MEMO, cfg.FunderPub, len(pairs), size)
+  if err != nil { return nil, err }
+
+  // Several transactions in flight at once, each from a channel account
+  if cfg.Channels > 0 {
+    return fundWithChannels(ctx, cfg, client, pairs, amounts, signers, size)
+  }
+
+  funder := AccountFunder{
+    Amounts: amounts,
+    Pub: cfg.FunderPub,
+    Sec: cfg.FunderSec,
+    Signers: signers,
+    Network: cfg.network(),
+    Memo: cfg.memo(cfg.FundMemo),
+    InfDest: cfg.combinedInflationDest(),
+  }
+  creator := TransactionCreator(funder)
+  sub := cfg.submitter(client, PHASE_FUND)
+
+  // Fund the accounts from the funder's balance, size per transaction
+  var succeeded Voters
+  for processed := 0; processed < len(pairs); {
+    if ctx.Err() != nil { return succeeded, ctx.Err() }
+    // Indexes of the pairs that will be funded
+    a := processed
+    b := processed + size
+    // Make sure we don't overflow
+    if b > len(pairs) {
+      b = len(pairs)
+    }
+    log.Println("Process from #", a, "to #", b-1)
+
+    // The funder's sequence number is only fetched for the first transaction
+    succeeded = append(succeeded, fundBatch(cfg, sub, &creator, a / size, pairs[a:b])...)
+    log.Println("### SUCCEEDED:", len(succeeded))
+
+    // We have processed up to 'b' already
+    processed = b
+  }
+  return succeeded, nil
+}
+
+// Funds one batch of pairs, recording the results in the journal.
+// Returns the pairs funded
+func fundBatch(cfg Config, sub *submitter, creator *TransactionCreator, batch int, pairs Voters) Voters {
+  ok, txRes, failed := sub.createAndSubmit(creator, batch, pairs)
+  if txRes != nil {
+    cfg.Journal.Funded(ok, txRes.Hash)
+    if cfg.Combined {
+      cfg.Journal.InflationSet(ok, txRes.Hash)
+    }
+  }
+  // Accounts that already exist were funded before (e.g. by an interrupted run)
+  var existing Voters
+  for _, p := range pairs {
+    if failed[p.Address()] == "op_already_exists" {
+      existing = append(existing, p)
+      delete(failed, p.Address())
+    }
+  }
+  cfg.Journal.Funded(existing, "")
+  cfg.Journal.Failed(PHASE_FUND, failed)
+  return append(ok, existing...)
+}
+
+func fundWithFriendBot(ctx context.Context, url string, pairs Voters) (Voters, error) {
+  var wg sync.WaitGroup
+  // Set up the WaitGroup
+  guard := make(chan struct{}, WG_MAX)
+  // Set up the channel to store the indexes of successfully funded pairs
+  successChan := make(chan int, len(pairs))
+
+  // Ask the friendbot to fund each pair, using goroutines
+  for i, p := range pairs {
+    if ctx.Err() != nil { break }
+    // Use an empty struct to mark that a new goroutine will be used
+    // This blocks when guard is full
+    guard<- struct{}{}
+    wg.Add(1)
+    // Start the goroutine
+    go func(i int, p *keypair.Full, success chan int) {
+      defer wg.Done()
+      // Returns true if the friendbot successfully funded p
+      if askFriendBot(url, p) {
+        success<- i
+      }
+      // Remove one element from the guard, allowing a new goroutine to run
+      <-guard
+    }(i, p, successChan)
+  }
+
+  // Wait for all the goroutines to finish
+  wg.Wait()
+  // Create a new slice to hold only the funded accounts
+  var tmp Voters
+  // Proccess the results
+  sinkProcess:
+  for {
+    select {
+    case i := <-successChan:
+      tmp = append(tmp, pairs[i])
+      break
+    default:
+      break sinkProcess
+    }
+  }
+  return tmp, ctx.Err()
+}
+
+// SetInflation sets cfg.InflationDest as the inflation destination of pairs,
+// SIGNERS_PER_TX_MAX per transaction (less the signers of cfg.FeePayer).
+// Returns the keypairs successfully set
+func SetInflation(ctx context.Context, cfg Config, client Horizon, pairs Voters) (Voters, error) {
+  var wg sync.WaitGroup
+  err := cfg.Validate()
+  if err != nil { return nil, err }
+
+  // Every signature counts, the fee payer's and the voters'
+  feeSigners, err := feePayerSigners(client, cfg)
+  if err != nil { return nil, err }
+  perTx := SIGNERS_PER_TX_MAX - len(feeSigners)
+  if perTx < 1 {
+    return nil, errors.New("the fee payer has too many signers")
+  }
+  err = cfg.checkMemo(cfg.InflationMemo, INFLATION_MEMO, cfg.InflationDest, len(pairs), perTx)
+  if err != nil { return nil, err }
+  workers := WG_MAX
+  if cfg.FeePayer != "" {
+    // The transactions of one source must be submitted in order
+    workers = 1
+  }
+
+  ceil := math.Ceil(float64(len(pairs)) / float64(perTx))
+  guard := make(chan struct{}, workers)
+  respChan := make(chan Voters, int(ceil))
+
+  inf := InflationSetter{
+    C: client,
+    InfDest: cfg.InflationDest,
+    Network: cfg.network(),
+    Memo: cfg.memo(cfg.InflationMemo),
+    FeeSource: cfg.FeePayer,
+    FeeSigners: feeSigners,
+  }
+  creator := TransactionCreator(inf)
+  sub := cfg.submitter(client, PHASE_INFLATION)
+
+  // Set their Inflation Destination, perTx per transaction
+  for a := 0; a < len(pairs); a += perTx {
+    if ctx.Err() != nil { break }
+    // Indexes of the pairs that will have operations in the transaction
+    b := a + perTx
+    // Make sure we don't overflow
+    if b > len(pairs) {
+      b = len(pairs)
+    }
+    log.Println("Setting from #", a, "to #", b-1)
+
+    // Use an empty struct to mark that a new goroutine will be used
+    // This blocks when guard is full
+    guard<- struct{}{}
+    wg.Add(1)
+    // Start the goroutine
+    go func(a int, b int, resp chan Voters) {
+      defer wg.Done()
+
+      ok, txRes, failed := sub.createAndSubmit(&creator, a / perTx, pairs[a:b])
+      if txRes != nil {
+        cfg.Journal.InflationSet(ok, txRes.Hash)
+      }
+      cfg.Journal.Failed(PHASE_INFLATION, failed)
+      resp<- ok
+      <-guard
+    }(a, b, respChan)
+  }
+
+  // Wait for all the goroutines to finish
+  wg.Wait()
+  // Proccess the results
+  var succeeded Voters
+  process:
+  for {
+    select {
+    case r := <-respChan:
+      succeeded = append(succeeded, r...)
+      break
+    default:
+      break process
+    }
+  }
+  log.Println("### Final succeeded:", len(succeeded))
+  return succeeded, ctx.Err()
+}
@@ -0,0 +1,365 @@
+package pool
+
+import (
+  "os"
+  "testing"
+  "context"
+  "io/ioutil"
+  "path/filepath"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/keypair"
+  "github.com/matheusb-comp/stellar-create-pool/horizontest"
+)
+
+// Balance of the funder of the tests, in stroops (1000 XLM)
+const TEST_FUNDER_BALANCE = 10000000000
+
+// Starts a fake Horizon with a funder account, and a configuration that
+// saves the accounts in a temporary directory. Call the returned function
+// when done
+func testRun(t *testing.T) (*horizontest.Server, *keypair.Full, Config, func()) {
+  srv := horizontest.NewServer(build.TestNetwork)
+  funder, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  srv.AddAccount(funder.Address(), TEST_FUNDER_BALANCE)
+
+  dir, err := ioutil.TempDir("", "pool")
+  if err != nil { t.Fatal(err) }
+  cfg := Config{
+    Horizon: HorizonClient{srv.Client()},
+    FunderPub: funder.Address(),
+    FunderSec: funder.Seed(),
+    NumAccounts: 25,
+    NumOps: 10,
+    // Enough for the first account of each batch to pay the fee
+    MinBalance: 40000000,
+    MaxBalance: 60000000,
+    OutputFile: filepath.Join(dir, "accounts"),
+  }
+  return srv, funder, cfg, func() {
+    srv.Close()
+    os.RemoveAll(dir)
+  }
+}
+
+// Checks that every account exists on the server, voting for infDest
+func checkVoters(t *testing.T, srv *horizontest.Server, pairs Voters, infDest string) {
+  for _, p := range pairs {
+    a, ok := srv.Account(p.Address())
+    if !ok {
+      t.Errorf("%s was not created", p.Address())
+      continue
+    }
+    if a.InflationDest != infDest {
+      t.Errorf("%s votes for %q, expected %s", p.Address(), a.InflationDest, infDest)
+    }
+  }
+}
+
+// Checks the number of accounts that made it through each phase
+func checkResult(t *testing.T, res *Result, num int) {
+  if len(res.Generated) != num || len(res.Funded) != num || len(res.Inflated) != num {
+    t.Fatalf("generated %d, funded %d and set %d accounts, expected %d",
+      len(res.Generated), len(res.Funded), len(res.Inflated), num)
+  }
+}
+
+func TestRun(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+  checkVoters(t, srv, res.Generated, funder.Address())
+
+  // Every account is saved with its final state
+  voters, err := ReadVoters(cfg.OutputFile, "")
+  if err != nil { t.Fatal(err) }
+  if len(voters) != cfg.NumAccounts {
+    t.Fatalf("saved %d accounts, expected %d", len(voters), cfg.NumAccounts)
+  }
+  for _, v := range voters {
+    if v.Status != STATE_INFLATION_SET || v.FundTx == "" || v.InflationTx == "" {
+      t.Errorf("%s saved as %q (fund_tx %q, inflation_tx %q)", v.Pub, v.Status, v.FundTx, v.InflationTx)
+    }
+  }
+}
+
+func TestRunCombined(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.Combined = true
+  cfg.Report = NewReport()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+  checkVoters(t, srv, res.Generated, funder.Address())
+
+  // Only funding transactions, with NumOps/2 accounts each
+  for _, tx := range cfg.Report.Transactions {
+    if tx.Phase != PHASE_FUND {
+      t.Errorf("unexpected %s transaction", tx.Phase)
+    }
+  }
+  if len(cfg.Report.Transactions) != 5 {
+    t.Errorf("submitted %d transactions, expected 5", len(cfg.Report.Transactions))
+  }
+}
+
+func TestRunMultisigFunder(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cosigner, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  srv.SetSigners(funder.Address(), map[string]int32{cosigner.Address(): 1}, 2)
+
+  // The master key alone is below the medium threshold
+  _, err = Run(context.Background(), cfg)
+  if err == nil { t.Fatal("funded without reaching the medium threshold") }
+
+  cfg.OutputFile += "_multisig"
+  cfg.FunderSigners = []Signer{KeypairSigner{cosigner}}
+  // The funder also pays the fees of the inflation transactions
+  cfg.FeePayer = funder.Address()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+  checkVoters(t, srv, res.Generated, funder.Address())
+}
+
+func TestRunChannels(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.Channels = 3
+  cfg.ChannelsFile = cfg.OutputFile + "_channels"
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+  checkVoters(t, srv, res.Generated, funder.Address())
+
+  // The channels were merged back into the funder
+  if srv.Accounts() != cfg.NumAccounts + 1 {
+    t.Errorf("%d accounts exist, expected %d", srv.Accounts(), cfg.NumAccounts + 1)
+  }
+  if _, err := os.Stat(cfg.ChannelsFile + ".json"); !os.IsNotExist(err) {
+    t.Errorf("the channels file was not removed")
+  }
+}
+
+func TestRunDryRun(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  saved := []VoterJSON{{Pub: "funded", Sec: "seed", Status: STATE_INFLATION_SET}}
+  err := SaveVoters(cfg.OutputFile, saved, "")
+  if err != nil { t.Fatal(err) }
+
+  cfg.DryRun = NewDryRun()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+
+  // Nothing was submitted, and the output file was left as it was
+  if srv.Accounts() != 1 {
+    t.Errorf("%d accounts exist, expected only the funder", srv.Accounts())
+  }
+  voters, err := ReadVoters(cfg.OutputFile, "")
+  if err != nil { t.Fatal(err) }
+  if len(voters) != 1 || voters[0].Pub != "funded" {
+    t.Errorf("the dry run replaced the output file")
+  }
+}
+
+func TestRunKeepsEarlierFiles(t *testing.T) {
+  _, _, cfg, done := testRun(t)
+  defer done()
+  saved := []VoterJSON{{Pub: "funded", Sec: "seed", Status: STATE_INFLATION_SET}}
+  err := SaveVoters(cfg.OutputFile, saved, "")
+  if err != nil { t.Fatal(err) }
+
+  cfg.Report = NewReport()
+  _, err = Run(context.Background(), cfg)
+  if err == nil { t.Fatal("replaced the output file of an earlier run") }
+  // The report of a run that never started has its error
+  if cfg.Report.Finished.IsZero() || cfg.Report.Error == "" {
+    t.Errorf("the report has no finish time or error")
+  }
+  cfg.Report = nil
+  cfg.Overwrite = true
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  checkResult(t, res, cfg.NumAccounts)
+
+  // A journal with accounts is only opened to resume it
+  j, err := OpenJournal(cfg.OutputFile, false, "")
+  if err != nil { t.Fatal(err) }
+  j.Generated(res.Generated)
+  j.Close()
+  if _, err = OpenJournal(cfg.OutputFile, false, ""); err == nil {
+    t.Error("truncated a journal with accounts")
+  }
+  j, err = OpenJournal(cfg.OutputFile, true, "")
+  if err != nil { t.Fatal(err) }
+  j.Close()
+  // Never adding encrypted and clear text seeds to the same journal
+  if _, err = OpenJournal(cfg.OutputFile, true, "passphrase"); err == nil {
+    t.Error("resumed a clear text journal with a passphrase")
+  }
+}
+
+func TestFundReportsResubmissions(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  cfg.NumOps = 100
+  cfg.Report = NewReport()
+  pairs, err := Generate(5)
+  if err != nil { t.Fatal(err) }
+  // Creating an existing account fails the first transaction
+  srv.AddAccount(pairs[2].Address(), 1000000000)
+
+  funded, err := Fund(context.Background(), cfg, cfg.Horizon, pairs)
+  if err != nil { t.Fatal(err) }
+  // The existing account counts as funded before
+  if len(funded) != 5 {
+    t.Fatalf("funded %d accounts, expected 5", len(funded))
+  }
+  // The failed transaction (in the ledger) and its resubmission
+  txs := cfg.Report.Transactions
+  if len(txs) != 2 || txs[0].Code != "tx_failed" || txs[1].Code != "" {
+    t.Fatalf("reported %+v, expected a tx_failed and a successful transaction", txs)
+  }
+  if txs[0].Hash == "" || txs[0].Hash == txs[1].Hash || txs[0].Operations != 5 || txs[1].Operations != 4 {
+    t.Errorf("reported %+v, expected both hashes, with 5 and 4 operations", txs)
+  }
+}
+
+func TestDissolve(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  cfg.Journal = NewJournal()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  // An account recorded as funded that isn't on the network
+  missing, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  cfg.Journal.Generated(Voters{missing})
+  cfg.Journal.Funded(Voters{missing}, "")
+
+  report, err := Dissolve(context.Background(), cfg, cfg.Horizon, append(res.Generated, missing))
+  if err != nil { t.Fatal(err) }
+  if len(report.Merged) != cfg.NumAccounts || report.Failed[missing.Address()] != "not_found" {
+    t.Errorf("merged %d accounts and failed %v, expected %d and the missing one",
+      len(report.Merged), report.Failed, cfg.NumAccounts)
+  }
+  if srv.Accounts() != 1 {
+    t.Errorf("%d accounts exist, expected only the funder", srv.Accounts())
+  }
+  // The journal keeps the state of the account not found
+  for _, e := range cfg.Journal.Entries() {
+    if e.Pub == missing.Address() && e.State != STATE_FUNDED {
+      t.Errorf("the missing account is %s in the journal, expected %s", e.State, STATE_FUNDED)
+    }
+  }
+}
+
+func TestDissolveRetriesFailed(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  cfg.NumAccounts = 5
+  cfg.Journal = NewJournal()
+  _, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+
+  // Every merge fails
+  client := failingHorizon{cfg.Horizon, nil}
+  report, err := Dissolve(context.Background(), cfg, client, cfg.Journal.Existing())
+  if err != nil { t.Fatal(err) }
+  if len(report.Merged) != 0 || len(report.Failed) != cfg.NumAccounts {
+    t.Fatalf("merged %d and failed %d accounts", len(report.Merged), len(report.Failed))
+  }
+  // They aren't funded or set again, but dissolving again retries them
+  toFund, toSet, set := cfg.Journal.Pending()
+  if len(toFund) + len(toSet) + len(set) != 0 {
+    t.Errorf("%d accounts to fund, %d to set and %d done, expected none", len(toFund), len(toSet), len(set))
+  }
+  existing := cfg.Journal.Existing()
+  if len(existing) != cfg.NumAccounts {
+    t.Fatalf("%d accounts exist in the journal, expected %d", len(existing), cfg.NumAccounts)
+  }
+
+  report, err = Dissolve(context.Background(), cfg, cfg.Horizon, existing)
+  if err != nil { t.Fatal(err) }
+  if len(report.Merged) != cfg.NumAccounts {
+    t.Errorf("merged %d accounts, expected %d", len(report.Merged), cfg.NumAccounts)
+  }
+  if len(cfg.Journal.Existing()) != 0 || srv.Accounts() != 1 {
+    t.Errorf("%d accounts exist, expected only the funder", srv.Accounts())
+  }
+}
+
+func TestRunKeepsChannels(t *testing.T) {
+  _, _, cfg, done := testRun(t)
+  defer done()
+  cfg.Channels = 3
+  cfg.ChannelsFile = cfg.OutputFile + "_channels"
+  // Channels left by an interrupted run
+  channels, err := Generate(4)
+  if err != nil { t.Fatal(err) }
+  err = SaveJSON(cfg.ChannelsFile, channels, "")
+  if err != nil { t.Fatal(err) }
+
+  _, err = Run(context.Background(), cfg)
+  if err == nil { t.Fatal("dropped channels of an interrupted run") }
+  saved, err := ReadJSON(cfg.ChannelsFile, "")
+  if err != nil { t.Fatal(err) }
+  if len(saved) != 4 {
+    t.Errorf("the channels file has %d keys, expected 4", len(saved))
+  }
+}
+
+func TestMigrate(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.NumAccounts = 5
+  cfg.Journal = NewJournal()
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  dest, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  srv.AddAccount(dest.Address(), 100000000)
+  missing, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  pairs := append(res.Generated, missing)
+  // Failure of an earlier run, the account votes for the funder since then
+  cfg.Journal.Failed(PHASE_INFLATION, map[string]string{pairs[0].Address(): "op_stale"})
+
+  cfg.MigrateFrom = funder.Address()
+  cfg.InflationDest = dest.Address()
+  check := func(report *MigrateReport, migrated bool, after string, code string) {
+    for i, a := range report.Accounts[:cfg.NumAccounts] {
+      if a.Pub != pairs[i].Address() || a.Migrated != migrated || a.After != after || a.Code != code {
+        t.Errorf("reported %+v, expected migrated %v to %s (code %q)", a, migrated, after, code)
+      }
+    }
+    if a := report.Accounts[cfg.NumAccounts]; a.Code != MIGRATE_NOT_FOUND {
+      t.Errorf("reported the missing account as %+v", a)
+    }
+  }
+
+  // Nothing is sent without the secret of the fee payer
+  broken := cfg
+  broken.FeePayer = dest.Address()
+  report, err := Migrate(context.Background(), broken, cfg.Horizon, pairs)
+  if err == nil { t.Fatal("migrated without the secret of the fee payer") }
+  check(report, false, funder.Address(), MIGRATE_NOT_SET)
+  if report.Migrated != 0 || report.Failed != cfg.NumAccounts + 1 {
+    t.Errorf("migrated %d and failed %d accounts", report.Migrated, report.Failed)
+  }
+
+  report, err = Migrate(context.Background(), cfg, cfg.Horizon, pairs)
+  if err != nil { t.Fatal(err) }
+  check(report, true, dest.Address(), "")
+  if report.Migrated != cfg.NumAccounts || report.Failed != 1 {
+    t.Errorf("migrated %d and failed %d accounts", report.Migrated, report.Failed)
+  }
+  checkVoters(t, srv, res.Generated, dest.Address())
+}
@@ -0,0 +1,108 @@
+package pool
+
+import (
+  "os"
+  "log"
+  "sync"
+  "time"
+  "encoding/json"
+)
+
+// Report of a run, with every transaction submitted and the final state
+// of every account (without the secret seeds)
+type Report struct {
+  // Identifies the run in the memos of its transactions
+  RunID string `json:"run_id,omitempty"`
+  Started time.Time `json:"started"`
+  Finished time.Time `json:"finished"`
+  Error string `json:"error,omitempty"`
+  Transactions []TransactionReport `json:"transactions"`
+  Accounts []AccountReport `json:"accounts"`
+  mu sync.Mutex
+}
+
+// TransactionReport is the outcome of a transaction, a batch of operations
+// has one for every transaction built for it. It failed if Code is not ""
+type TransactionReport struct {
+  Phase string `json:"phase"`
+  // Index of the batch in its phase
+  Batch int `json:"batch"`
+  Hash string `json:"hash,omitempty"`
+  Ledger int32 `json:"ledger,omitempty"`
+  Operations int `json:"operations"`
+  // Number of times the transaction was submitted to Horizon
+  Attempts int `json:"attempts"`
+  Code string `json:"code,omitempty"`
+}
+
+// AccountReport is the final state of an account
+type AccountReport struct {
+  Pub string `json:"pub"`
+  Status string `json:"status"`
+  FundTx string `json:"fund_tx,omitempty"`
+  InflationTx string `json:"inflation_tx,omitempty"`
+  MergeTx string `json:"merge_tx,omitempty"`
+  FailedPhase string `json:"failed_phase,omitempty"`
+  Code string `json:"code,omitempty"`
+}
+
+func NewReport() *Report {
+  return &Report{Started: time.Now()}
+}
+
+// Adds the transaction to the report, does nothing on a nil Report
+func (r *Report) add(t TransactionReport) {
+  if r == nil { return }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.Transactions = append(r.Transactions, t)
+}
+
+// Records the ID of the run, if it isn't set yet
+func (r *Report) setRunID(id string) {
+  if r == nil { return }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if r.RunID == "" {
+    r.RunID = id
+  }
+}
+
+// Finish sets the end of the run, its error and the state of the accounts
+// in the journal
+func (r *Report) Finish(j *Journal, err error) {
+  if r == nil { return }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.Finished = time.Now()
+  if err != nil {
+    r.Error = err.Error()
+  }
+  r.Accounts = nil
+  if j == nil { return }
+  for _, e := range j.Entries() {
+    r.Accounts = append(r.Accounts, AccountReport{
+      Pub: e.Pub,
+      Status: e.State,
+      FundTx: e.FundTx,
+      InflationTx: e.InflationTx,
+      MergeTx: e.MergeTx,
+      FailedPhase: e.FailedPhase,
+      Code: e.Code,
+    })
+  }
+}
+
+// Save writes the report to the file name + ".json"
+func (r *Report) Save(name string) error {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  log.Println("Saving the report to", name + ".json", "...")
+  err := writeFileAtomic(name + ".json", func(f *os.File) error {
+    enc := json.NewEncoder(f)
+    enc.SetIndent("", " ")
+    return enc.Encode(r)
+  })
+  logErr(err, "Error saving the report:")
+  return err
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+  "sync"
+)
+
+// Sequences keeps the next sequence number of each transaction source,
+// fetching it from Horizon only the first time (or after a Reset) and
+// advancing it locally for every transaction built
+type Sequences struct {
+  c Horizon
+  mu sync.Mutex
+  next map[string]uint64
+}
+
+func NewSequences(c Horizon) *Sequences {
+  return &Sequences{
+    c: c,
+    next: make(map[string]uint64),
+  }
+}
+
+// Next returns the sequence number for a new transaction from address,
+// and advances it
+func (s *Sequences) Next(address string) (uint64, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  seq, ok := s.next[address]
+  if !ok {
+    var err error
+    seq, err = getSequence(s.c, address)
+    if err != nil { return 0, err }
+  }
+  s.next[address] = seq + 1
+  return seq, nil
+}
+
+// Reset forgets the sequence number of address, so it is fetched from
+// Horizon again. Used when a transaction didn't consume its sequence number
+// (like tx_bad_seq) or it isn't known if it did
+func (s *Sequences) Reset(address string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  delete(s.next, address)
+}
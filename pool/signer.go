@@ -0,0 +1,122 @@
+package pool
+
+import (
+  "bytes"
+  "errors"
+  "net/http"
+  "encoding/hex"
+  "encoding/json"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/keypair"
+)
+
+// Signer signs transactions for an account, without exposing its secret seed
+type Signer interface {
+  // Address of the key that signs
+  Address() string
+  // Sign returns the decorated signature of the transaction hash
+  Sign(hash [32]byte) (xdr.DecoratedSignature, error)
+}
+
+// Signs with a keypair kept in memory
+type KeypairSigner struct {
+  KP *keypair.Full
+}
+
+// Signs by sending the transaction hash to a signing service, like
+// signertest. The service answers with a decorated signature, which is
+// checked against Pub before being used
+type RemoteSigner struct {
+  // URL that receives the SignRequest
+  URL string
+  // Address of the key held by the service
+  Pub string
+  // Sent as a bearer token, if not ""
+  Token string
+  // HTTP client to use (default: http.DefaultClient)
+  HTTP *http.Client
+}
+
+// SignRequest is the body sent to the signing service
+type SignRequest struct {
+  Address string `json:"address"`
+  // Hex encoded hash of the transaction
+  Hash string `json:"hash"`
+}
+
+// SignResponse is the body answered by the signing service
+type SignResponse struct {
+  // Base64 encoded XDR of the DecoratedSignature
+  Signature string `json:"signature,omitempty"`
+  Error string `json:"error,omitempty"`
+}
+
+// SeedSigner returns a KeypairSigner for the secret seed
+func SeedSigner(seed string) (Signer, error) {
+  kp, err := keypair.Parse(seed)
+  if err != nil { return nil, err }
+  full, ok := kp.(*keypair.Full)
+  if !ok { return nil, errors.New("not a secret seed") }
+  return KeypairSigner{full}, nil
+}
+
+func (s KeypairSigner) Address() string {
+  return s.KP.Address()
+}
+
+func (s KeypairSigner) Sign(hash [32]byte) (xdr.DecoratedSignature, error) {
+  return s.KP.SignDecorated(hash[:])
+}
+
+func (s *RemoteSigner) Address() string {
+  return s.Pub
+}
+
+func (s *RemoteSigner) Sign(hash [32]byte) (xdr.DecoratedSignature, error) {
+  var sig xdr.DecoratedSignature
+  body, err := json.Marshal(SignRequest{Address: s.Pub, Hash: hex.EncodeToString(hash[:])})
+  if err != nil { return sig, err }
+  req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+  if err != nil { return sig, err }
+  req.Header.Set("Content-Type", "application/json")
+  if s.Token != "" {
+    req.Header.Set("Authorization", "Bearer " + s.Token)
+  }
+  client := s.HTTP
+  if client == nil {
+    client = http.DefaultClient
+  }
+  resp, err := client.Do(req)
+  if err != nil { return sig, err }
+  defer resp.Body.Close()
+
+  var res SignResponse
+  err = json.NewDecoder(resp.Body).Decode(&res)
+  if err != nil { return sig, err }
+  if resp.StatusCode != http.StatusOK || res.Error != "" {
+    return sig, errors.New("signing service error: " + resp.Status + " " + res.Error)
+  }
+  err = xdr.SafeUnmarshalBase64(res.Signature, &sig)
+  if err != nil { return sig, err }
+
+  // Never trust the service to sign with the right key
+  kp, err := keypair.Parse(s.Pub)
+  if err != nil { return sig, err }
+  if sig.Hint != xdr.SignatureHint(kp.Hint()) {
+    return sig, errors.New("signing service answered with the hint of another key")
+  }
+  err = kp.Verify(hash[:], sig.Signature)
+  if err != nil {
+    return sig, errors.New("signing service answered with an invalid signature")
+  }
+  return sig, nil
+}
+
+// Signers for the pairs
+func pairSigners(pairs Voters) []Signer {
+  signers := make([]Signer, len(pairs))
+  for i, p := range pairs {
+    signers[i] = KeypairSigner{p}
+  }
+  return signers
+}
@@ -0,0 +1,133 @@
+package pool_test
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "context"
+  "net/http"
+  "io/ioutil"
+  "encoding/hex"
+  "path/filepath"
+  "encoding/json"
+  "net/http/httptest"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/keypair"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
+  "github.com/matheusb-comp/stellar-create-pool/signertest"
+  "github.com/matheusb-comp/stellar-create-pool/horizontest"
+)
+
+func randomKey(t *testing.T) *keypair.Full {
+  kp, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  return kp
+}
+
+// Signing service that answers for pub, but signs with kp. If flip is set,
+// it signs another hash than the requested one
+func forgingServer(t *testing.T, kp *keypair.Full, pub string, flip bool) (*pool.RemoteSigner, func()) {
+  srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    var req pool.SignRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
+    if err != nil { t.Error(err) }
+    hash, err := hex.DecodeString(req.Hash)
+    if err != nil { t.Error(err) }
+    if flip {
+      hash[0] ^= 0xff
+    }
+    sig, err := kp.SignDecorated(hash)
+    if err != nil { t.Error(err) }
+    sigb64, err := xdr.MarshalBase64(sig)
+    if err != nil { t.Error(err) }
+    json.NewEncoder(w).Encode(pool.SignResponse{Signature: sigb64})
+  }))
+  return &pool.RemoteSigner{URL: srv.URL, Pub: pub}, srv.Close
+}
+
+func TestRemoteSigner(t *testing.T) {
+  kp := randomKey(t)
+  var hash [32]byte
+  copy(hash[:], "transaction hash of the test....")
+
+  srv := signertest.NewServer(kp, "token")
+  defer srv.Close()
+  sig, err := srv.Signer().Sign(hash)
+  if err != nil { t.Fatal(err) }
+  if kp.Verify(hash[:], sig.Signature) != nil {
+    t.Errorf("the signature of the service is invalid")
+  }
+
+  other := randomKey(t)
+  tests := []struct {
+    name string
+    signer *pool.RemoteSigner
+    err string
+  }{
+    {"wrong token", &pool.RemoteSigner{URL: srv.URL, Pub: kp.Address(), Token: "other"}, "invalid token"},
+    {"no token", &pool.RemoteSigner{URL: srv.URL, Pub: kp.Address()}, "invalid token"},
+    {"mismatched key", &pool.RemoteSigner{URL: srv.URL, Pub: other.Address(), Token: "token"}, "no key for"},
+  }
+  for _, test := range tests {
+    _, err := test.signer.Sign(hash)
+    if err == nil || !strings.Contains(err.Error(), test.err) {
+      t.Errorf("%s: got error %v, expected %q", test.name, err, test.err)
+    }
+  }
+
+  // Answers of a service that can't be trusted
+  signer, done := forgingServer(t, other, kp.Address(), false)
+  defer done()
+  _, err = signer.Sign(hash)
+  if err == nil || !strings.Contains(err.Error(), "hint of another key") {
+    t.Errorf("signature of another key: got error %v", err)
+  }
+  signer, done = forgingServer(t, kp, kp.Address(), true)
+  defer done()
+  _, err = signer.Sign(hash)
+  if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+    t.Errorf("signature of another hash: got error %v", err)
+  }
+}
+
+func TestRunRemoteSigner(t *testing.T) {
+  srv := horizontest.NewServer(build.TestNetwork)
+  defer srv.Close()
+  funder := randomKey(t)
+  cosigner := randomKey(t)
+  srv.AddAccount(funder.Address(), 10000000000)
+  srv.SetSigners(funder.Address(), map[string]int32{cosigner.Address(): 1}, 2)
+  signer := signertest.NewServer(cosigner, "token")
+  defer signer.Close()
+
+  dir, err := ioutil.TempDir("", "pool")
+  if err != nil { t.Fatal(err) }
+  defer os.RemoveAll(dir)
+  cfg := pool.Config{
+    Horizon: pool.HorizonClient{srv.Client()},
+    FunderPub: funder.Address(),
+    FunderSec: funder.Seed(),
+    NumAccounts: 5,
+    NumOps: 10,
+    MinBalance: 40000000,
+    MaxBalance: 60000000,
+    OutputFile: filepath.Join(dir, "accounts"),
+  }
+
+  // Nothing is funded when the service refuses to sign
+  cfg.FunderSigners = []pool.Signer{&pool.RemoteSigner{URL: signer.URL, Pub: cosigner.Address(), Token: "other"}}
+  res, err := pool.Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  if len(res.Funded) != 0 || srv.Accounts() != 1 {
+    t.Errorf("%d accounts exist, expected only the funder", srv.Accounts())
+  }
+
+  cfg.OutputFile += "_remote"
+  cfg.FunderSigners = []pool.Signer{signer.Signer()}
+  res, err = pool.Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+  if len(res.Inflated) != cfg.NumAccounts {
+    t.Errorf("set the inflation of %d accounts, expected %d", len(res.Inflated), cfg.NumAccounts)
+  }
+}
@@ -0,0 +1,316 @@
+package pool
+
+import (
+  "log"
+  "time"
+  "strconv"
+  "encoding/hex"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/network"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Submits the transactions of one phase, recording them in the dry run
+// (instead of submitting them) and in the report
+type submitter struct {
+  c Horizon
+  dry *DryRun
+  report *Report
+  seqs *Sequences
+  fees *feeLevel
+  network build.Network
+  // Transactions expire this long after being built (never if 0)
+  timeout time.Duration
+  phase string
+}
+
+func (cfg *Config) submitter(client Horizon, phase string) *submitter {
+  return &submitter{
+    c: client,
+    dry: cfg.DryRun,
+    report: cfg.Report,
+    seqs: NewSequences(client),
+    fees: &feeLevel{fee: cfg.baseFee(client), max: cfg.MaxFee},
+    network: cfg.network(),
+    timeout: cfg.TxTimeout,
+    phase: phase,
+  }
+}
+
+// Creates and submits the transaction for pairs, retrying without the pairs
+// whose operations failed, with a fresh sequence number after tx_bad_seq or
+// tx_too_late (once it is sure the transaction didn't land), or with a
+// higher fee after tx_insufficient_fee.
+// Returns the pairs that succeeded, the successful submission (nil if none)
+// and the failure code of every other pair
+func (s *submitter) createAndSubmit(src *TransactionCreator, batch int, pairs Voters) (Voters, *horizon.TransactionSuccess, map[string]string) {
+  failed := make(map[string]string)
+  // Mark all the remaining pairs as failed with the same code
+  failAll := func(code string) {
+    for _, p := range pairs {
+      failed[p.Address()] = code
+    }
+  }
+  // Outcome of the transaction being submitted, added to the report before
+  // building the next one, or when returning
+  rep := TransactionReport{Phase: s.phase, Batch: batch}
+  defer func() { s.report.add(rep) }()
+
+  // Fee of each operation, raised while the network is congested
+  opts := TxOptions{BaseFee: s.fees.get(), Batch: batch}
+
+  // Create and submit the transaction (retry if some operations fail)
+  for count, badSeqs, expired := 1, 0, 0; ; count++ {
+    // Every transaction submitted has its own entry (failed ones may be in
+    // the ledger, charging the fee)
+    if count > 1 {
+      s.report.add(rep)
+      rep = TransactionReport{Phase: s.phase, Batch: batch}
+    }
+    rep.Operations = len(pairs)
+    // Get the sequence number of the transaction source
+    source := (*src).Source(pairs)
+    seq, err := s.nextSequence(source)
+    if logErr(err, "Error getting the sequence of " + source + " from Horizon:") {
+      rep.Code = "tx_sequence_error"
+      failAll(rep.Code)
+      return Voters{}, nil, failed
+    }
+
+    // Fresh time bounds for every transaction built
+    if s.timeout > 0 {
+      opts.MaxTime = uint64(time.Now().Add(s.timeout).Unix())
+    }
+
+    // Get the signed Transaction Envelope
+    xdr, notOk := (*src).CreateTransaction(seq, opts, pairs)
+    // Failed to create the transaction, no pair succeeded, stop trying
+    if notOk {
+      // The sequence number wasn't used
+      s.seqs.Reset(source)
+      rep.Code = "tx_build_error"
+      failAll(rep.Code)
+      return Voters{}, nil, failed
+    }
+
+    // Only record the transaction, assuming all the operations succeed
+    if s.dry != nil {
+      hash, err := s.dry.Record(xdr)
+      if logErr(err, "Error recording the transaction:") {
+        rep.Code = "tx_build_error"
+        failAll(rep.Code)
+        return Voters{}, nil, failed
+      }
+      rep.Hash = hash
+      rep.Code = "dry_run"
+      return pairs, &horizon.TransactionSuccess{Hash: hash, Env: xdr}, failed
+    }
+
+    // Submit the transaction
+    rep.Hash, _ = s.hash(xdr)
+    res, attempts, err := submit(s.c, xdr)
+    rep.Attempts = attempts
+    if logErr(err, "Transaction submission error (try #" + strconv.Itoa(count) + "):") {
+      // Log the XDR of the failed transaction
+      log.Println("XDR of the failed transaction:", xdr)
+      // Log the specific Horizon errors and get the Transaction Codes
+      codes, notOk := checkHorizonError(err)
+      // The error is not from horizon, or it didn't fail because of the operations
+      if notOk {
+        // It isn't known if the transaction used the sequence number
+        s.seqs.Reset(source)
+        rep.Code = "tx_submission_error"
+        failAll(rep.Code)
+        return Voters{}, nil, failed
+      }
+      rep.Code = codes.TransactionCode
+      // An earlier submission (before a 504) may have landed, building the
+      // transaction again would send everything twice
+      if codes.TransactionCode == "tx_too_late" || codes.TransactionCode == "tx_bad_seq" && attempts > 1 {
+        landed, err := s.landed(xdr)
+        if logErr(err, "Error checking if the transaction landed:") {
+          s.seqs.Reset(source)
+          rep.Code = "tx_unknown_result"
+          failAll(rep.Code)
+          return Voters{}, nil, failed
+        }
+        if landed != nil {
+          log.Println("The transaction landed in an earlier submission:", landed.Hash)
+          rep.Hash = landed.Hash
+          rep.Ledger = landed.Ledger
+          rep.Code = ""
+          return pairs, landed, failed
+        }
+      }
+      if codes.TransactionCode != "tx_failed" {
+        // Only transactions that reach the operations use the sequence number
+        s.seqs.Reset(source)
+        // Try again with the sequence number from Horizon
+        if codes.TransactionCode == "tx_bad_seq" && badSeqs < BAD_SEQ_RETRIES_MAX {
+          badSeqs++
+          log.Println("Bad sequence number", seq, "for", source, "- fetching it again")
+          continue
+        }
+        // It expired without landing, build it again with new time bounds
+        if codes.TransactionCode == "tx_too_late" && expired < BAD_SEQ_RETRIES_MAX {
+          expired++
+          log.Println("Transaction expired - building it again")
+          continue
+        }
+        // Try again paying more, up to the max fee
+        if codes.TransactionCode == "tx_insufficient_fee" {
+          if fee, ok := s.fees.raise(opts.BaseFee); ok {
+            log.Println("Insufficient fee", opts.BaseFee, "- trying again with", fee)
+            opts.BaseFee = fee
+            continue
+          }
+        }
+        failAll(codes.TransactionCode)
+        return Voters{}, nil, failed
+      }
+
+      // Make pairs point to a new slice, with only the successfull elements.
+      // Each pair has the same number of operations, in order, and fails
+      // with the code of the first that didn't succeed
+      perPair := len(codes.OperationCodes) / len(pairs)
+      // Codes that don't match the pairs can't tell which ones failed
+      if perPair < 1 || perPair * len(pairs) != len(codes.OperationCodes) {
+        log.Println("Got", len(codes.OperationCodes), "operation codes for", len(pairs), "pairs")
+        failAll("tx_failed")
+        return Voters{}, nil, failed
+      }
+      var tmp Voters
+      for i, p := range pairs {
+        code := "op_success"
+        for _, c := range codes.OperationCodes[i * perPair:(i + 1) * perPair] {
+          if c != "op_success" {
+            code = c
+            break
+          }
+        }
+        if code == "op_success" {
+          tmp = append(tmp, p)
+        } else {
+          failed[p.Address()] = code
+        }
+      }
+      // Nothing left to submit
+      if len(tmp) == 0 {
+        return Voters{}, nil, failed
+      }
+      // Try again with the updated pairs (the failed transaction used seq)
+      pairs = tmp
+    } else {
+      // Transaction was successfull (with maybe less voters in pairs)
+      log.Println("Transaction Sent! Number of pairs:", len(pairs))
+      log.Println("\tLedger:", res.Ledger)
+      log.Println("\tHash:", res.Hash)
+      rep.Hash = res.Hash
+      rep.Ledger = res.Ledger
+      rep.Code = ""
+
+      // Return whatever pairs remain (the ones that succeeded)
+      return pairs, res, failed
+    }
+  }
+}
+
+// Hex encoded hash of the transaction in the envelope
+func (s *submitter) hash(txb64 string) (string, error) {
+  var env xdr.TransactionEnvelope
+  err := xdr.SafeUnmarshalBase64(txb64, &env)
+  if err != nil { return "", err }
+  hash, err := network.HashTransaction(&env.Tx, s.network.Passphrase)
+  if err != nil { return "", err }
+  return hex.EncodeToString(hash[:]), nil
+}
+
+// Returns the transaction if it succeeded in the ledger, or nil if it isn't
+// there or its operations failed
+func (s *submitter) landed(txb64 string) (*horizon.TransactionSuccess, error) {
+  hash, err := s.hash(txb64)
+  if err != nil { return nil, err }
+
+  tx, found, err := s.c.LoadTransaction(hash)
+  if err != nil || !found { return nil, err }
+  // It only used the sequence number, building it again sends nothing twice
+  if !tx.Successful {
+    log.Println("The transaction failed in an earlier submission:", tx.Hash)
+    return nil, nil
+  }
+  return &horizon.TransactionSuccess{Hash: tx.Hash, Ledger: tx.Ledger, Env: tx.Env, Result: tx.Result}, nil
+}
+
+// Submits the transaction, retrying while Horizon times out. Returns the
+// number of times the transaction was submitted
+func submit(client Horizon, xdr string) (*horizon.TransactionSuccess, int, error) {
+  var err error
+  var res horizon.TransactionSuccess
+  var count int
+  // Try susbmitting the transaction
+  for retry := true; retry; {
+    count++
+    res, err = client.SubmitTransaction(xdr)
+    // Type assertion to test if err is from Horizon (herr is nil if err is nil)
+    herr, isHorizonErr := err.(*horizon.Error)
+    // Wait some time and retry, if we got Status 504 (Gateway Timeout
+    if isHorizonErr && herr.Problem.Status == 504 {
+      log.Println("Horizon timed out:", herr.Problem.Type)
+      time.Sleep(TIMEOUT_WAIT_SECONDS * time.Second)
+      log.Println("Re-submitting...")
+      continue
+    }
+    // Do not retry, err == nil or it was not a timeout
+    retry = false
+  }
+  return &res, count, err
+}
+
+// Sequence number for the next transaction of address, projected
+// locally on dry runs
+func (s *submitter) nextSequence(address string) (uint64, error) {
+  if s.dry != nil {
+    return s.dry.Sequence(s.c, address)
+  }
+  return s.seqs.Next(address)
+}
+
+func getSequence(client Horizon, address string) (uint64, error) {
+  // Get the Sequence number for an account
+  // Returned type: xdr.SequenceNumber -> xdr.Int64 -> int64
+  seq, err := client.SequenceForAccount(address)
+  if err != nil || seq < 0 {
+    return 0, err
+  }
+  sequence := uint64(seq) + 1
+  return sequence, nil
+}
+
+func checkHorizonError(err error) (*horizon.TransactionResultCodes, bool) {
+  // Type assertion to test if err is from Horizon (herr is nil if err is nil)
+  herr, isHorizonErr := err.(*horizon.Error)
+  if !isHorizonErr {return nil, true}
+
+  // Log the Horizon Error Status
+  log.Println("\tError Status:", herr.Problem.Status, herr.Problem.Type)
+
+  // Log the Transaction Result String (base64)
+  str, err := herr.ResultString()
+  if !logErr(err, "\tError extracting the result string from the Horizon Error:") {
+    log.Println("\tTransaction result XDR:", str)
+  }
+
+  // Get the Transaction Result Codes
+  codes, err := herr.ResultCodes()
+  if logErr(err, "\tError extracting the result codes from the Horizon Error:") {
+    return nil, true
+  }
+
+  // Log and return the Transaction Result Codes
+  log.Println("\tTransaction result code:", codes.TransactionCode, "(" + strconv.Itoa(len(codes.OperationCodes)) + " op_codes)")
+  for i, c := range codes.OperationCodes {
+    log.Println("\t\tOperation", i, "result code:", c)
+  }
+  return codes, false
+}
@@ -0,0 +1,312 @@
+package pool
+
+import (
+  "time"
+  "testing"
+  "context"
+  "encoding/json"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/keypair"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Answers every transaction with tx_failed and the operation codes
+type failingHorizon struct {
+  Horizon
+  codes []string
+}
+
+func (h failingHorizon) SubmitTransaction(txb64 string) (horizon.TransactionSuccess, error) {
+  return horizon.TransactionSuccess{}, resultError("tx_failed", h.codes)
+}
+
+// Answers the first submissions with code, after sending them to the
+// server if forward is set (like an answer lost on the way back)
+type rejectingHorizon struct {
+  Horizon
+  code string
+  forward bool
+  // Submissions left to answer with code
+  left int
+  // Every transaction submitted
+  submitted []string
+}
+
+func (h *rejectingHorizon) SubmitTransaction(txb64 string) (horizon.TransactionSuccess, error) {
+  h.submitted = append(h.submitted, txb64)
+  if h.left == 0 {
+    return h.Horizon.SubmitTransaction(txb64)
+  }
+  h.left--
+  if h.forward {
+    h.Horizon.SubmitTransaction(txb64)
+  }
+  return horizon.TransactionSuccess{}, resultError(h.code, nil)
+}
+
+// Horizon error of a transaction rejected with the codes
+func resultError(code string, ops []string) error {
+  raw, _ := json.Marshal(horizon.TransactionResultCodes{TransactionCode: code, OperationCodes: ops})
+  return &horizon.Error{Problem: horizon.Problem{
+    Status: 400,
+    Extras: map[string]json.RawMessage{"result_codes": raw},
+  }}
+}
+
+// Signed transaction from the funder creating the account dest
+func createAccountTx(t *testing.T, s *submitter, funder *keypair.Full, dest string) string {
+  seq, err := s.nextSequence(funder.Address())
+  if err != nil { t.Fatal(err) }
+  tx, err := build.Transaction(
+    build.SourceAccount{AddressOrSeed: funder.Address()},
+    build.Sequence{Sequence: seq},
+    s.network,
+    build.CreateAccount(build.Destination{AddressOrSeed: dest}, build.NativeAmount{Amount: "2"}),
+  )
+  if err != nil { t.Fatal(err) }
+  txe, err := tx.Sign(funder.Seed())
+  if err != nil { t.Fatal(err) }
+  txb64, err := txe.Base64()
+  if err != nil { t.Fatal(err) }
+  return txb64
+}
+
+func TestLanded(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  s := cfg.submitter(cfg.Horizon, PHASE_FUND)
+  dest, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+
+  // Not submitted yet
+  txb64 := createAccountTx(t, s, funder, dest.Address())
+  landed, err := s.landed(txb64)
+  if err != nil || landed != nil {
+    t.Fatalf("landed %v (%v) before being submitted", landed, err)
+  }
+  _, _, err = submit(cfg.Horizon, txb64)
+  if err != nil { t.Fatal(err) }
+  landed, err = s.landed(txb64)
+  if err != nil || landed == nil {
+    t.Fatalf("not landed after being submitted (%v)", err)
+  }
+
+  // Horizon lists it, but its operation failed (the account exists)
+  txb64 = createAccountTx(t, s, funder, dest.Address())
+  _, _, err = submit(cfg.Horizon, txb64)
+  if err == nil { t.Fatal("created an account that already exists") }
+  landed, err = s.landed(txb64)
+  if err != nil || landed != nil {
+    t.Errorf("a failed transaction landed (%v)", err)
+  }
+  if _, ok := srv.Account(dest.Address()); !ok {
+    t.Errorf("%s was not created", dest.Address())
+  }
+}
+
+func TestFeeStats(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  srv.SetMinFee(300)
+  cfg.BaseFee = 100
+  cfg.FeeStats = "p90"
+  if fee := cfg.baseFee(cfg.Horizon); fee != 300 {
+    t.Errorf("base fee %d, expected the p90 of 300", fee)
+  }
+}
+
+func TestOperationCodesMismatch(t *testing.T) {
+  _, _, cfg, done := testRun(t)
+  defer done()
+  pairs, err := Generate(5)
+  if err != nil { t.Fatal(err) }
+
+  // Fewer codes than pairs, or a number that isn't a multiple
+  for _, codes := range [][]string{{"op_underfunded"}, make([]string, 7)} {
+    client := failingHorizon{cfg.Horizon, codes}
+    funded, err := Fund(context.Background(), cfg, client, pairs)
+    if err != nil { t.Fatal(err) }
+    if len(funded) != 0 {
+      t.Errorf("funded %d accounts with %d operation codes", len(funded), len(codes))
+    }
+  }
+}
+
+// Funds each pair with 5 XLM from the funder
+func testFunder(cfg Config, pairs Voters) TransactionCreator {
+  amounts := make(map[string]int64)
+  for _, p := range pairs {
+    amounts[p.Address()] = 50000000
+  }
+  return AccountFunder{
+    Amounts: amounts,
+    Pub: cfg.FunderPub,
+    Sec: cfg.FunderSec,
+    Network: cfg.network(),
+  }
+}
+
+// Checks the code of every transaction submitted, in order
+func checkCodes(t *testing.T, report *Report, codes ...string) {
+  if len(report.Transactions) != len(codes) {
+    t.Fatalf("submitted %d transactions, expected %d", len(report.Transactions), len(codes))
+  }
+  for i, tx := range report.Transactions {
+    if tx.Code != codes[i] {
+      t.Errorf("transaction %d failed with %q, expected %q", i, tx.Code, codes[i])
+    }
+  }
+}
+
+func TestBadSequence(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.Report = NewReport()
+  s := cfg.submitter(cfg.Horizon, PHASE_FUND)
+  pairs, err := Generate(4)
+  if err != nil { t.Fatal(err) }
+  creator := testFunder(cfg, pairs)
+
+  // The first batch leaves the next sequence number cached
+  funded, res, _ := s.createAndSubmit(&creator, 0, pairs[:2])
+  if res == nil || len(funded) != 2 { t.Fatal("the first batch failed") }
+
+  // Another transaction from the funder uses that sequence number
+  dest, err := keypair.Random()
+  if err != nil { t.Fatal(err) }
+  other := cfg.submitter(cfg.Horizon, PHASE_FUND)
+  _, _, err = submit(cfg.Horizon, createAccountTx(t, other, funder, dest.Address()))
+  if err != nil { t.Fatal(err) }
+
+  // The second batch is rejected, then lands with the sequence from Horizon
+  funded, res, failed := s.createAndSubmit(&creator, 1, pairs[2:])
+  if res == nil || len(funded) != 2 {
+    t.Fatalf("funded %d accounts after resyncing the sequence (%v)", len(funded), failed)
+  }
+  checkCodes(t, cfg.Report, "", "tx_bad_seq", "")
+  for _, p := range pairs {
+    if _, ok := srv.Account(p.Address()); !ok {
+      t.Errorf("%s was not created", p.Address())
+    }
+  }
+}
+
+// Decodes the fee of the transaction in the envelope
+func txFee(t *testing.T, txb64 string) uint64 {
+  var env xdr.TransactionEnvelope
+  err := xdr.SafeUnmarshalBase64(txb64, &env)
+  if err != nil { t.Fatal(err) }
+  return uint64(env.Tx.Fee)
+}
+
+func TestInsufficientFee(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  srv.SetMinFee(400)
+  cfg.BaseFee = 100
+  cfg.MaxFee = 1000
+  cfg.Report = NewReport()
+  s := cfg.submitter(cfg.Horizon, PHASE_FUND)
+  pairs, err := Generate(4)
+  if err != nil { t.Fatal(err) }
+  creator := testFunder(cfg, pairs)
+
+  // The fee is doubled until the network accepts it
+  funded, res, failed := s.createAndSubmit(&creator, 0, pairs[:2])
+  if res == nil || len(funded) != 2 {
+    t.Fatalf("funded %d accounts after raising the fee (%v)", len(funded), failed)
+  }
+  checkCodes(t, cfg.Report, "tx_insufficient_fee", "tx_insufficient_fee", "")
+  if fee := txFee(t, res.Env); fee != 400 * 2 {
+    t.Errorf("resubmitted paying %d, expected 400 for each of the 2 operations", fee)
+  }
+  // The next batches start from the raised fee
+  if fee := s.fees.get(); fee != 400 {
+    t.Errorf("the next batch pays %d, expected 400", fee)
+  }
+
+  // Never above the max fee
+  srv.SetMinFee(2000)
+  funded, res, failed = s.createAndSubmit(&creator, 1, pairs[2:])
+  if res != nil || len(funded) != 0 {
+    t.Fatalf("funded %d accounts paying more than the max fee", len(funded))
+  }
+  for _, p := range pairs[2:] {
+    if failed[p.Address()] != "tx_insufficient_fee" {
+      t.Errorf("%s failed with %q, expected tx_insufficient_fee", p.Address(), failed[p.Address()])
+    }
+  }
+}
+
+// Decodes the upper time bound of the transaction in the envelope
+func txMaxTime(t *testing.T, txb64 string) uint64 {
+  var env xdr.TransactionEnvelope
+  err := xdr.SafeUnmarshalBase64(txb64, &env)
+  if err != nil { t.Fatal(err) }
+  if env.Tx.TimeBounds == nil { return 0 }
+  return uint64(env.Tx.TimeBounds.MaxTime)
+}
+
+func TestTooLate(t *testing.T) {
+  srv, _, cfg, done := testRun(t)
+  defer done()
+  cfg.TxTimeout = time.Minute
+  cfg.Report = NewReport()
+  client := &rejectingHorizon{Horizon: cfg.Horizon, code: "tx_too_late", left: 1}
+  s := cfg.submitter(client, PHASE_FUND)
+  pairs, err := Generate(2)
+  if err != nil { t.Fatal(err) }
+  creator := testFunder(cfg, pairs)
+
+  // It expired without landing, so it is built again and lands
+  funded, res, failed := s.createAndSubmit(&creator, 0, pairs)
+  if res == nil || len(funded) != 2 {
+    t.Fatalf("funded %d accounts after the transaction expired (%v)", len(funded), failed)
+  }
+  checkCodes(t, cfg.Report, "tx_too_late", "")
+  if len(client.submitted) != 2 {
+    t.Fatalf("submitted %d transactions, expected 2", len(client.submitted))
+  }
+  first, second := txMaxTime(t, client.submitted[0]), txMaxTime(t, client.submitted[1])
+  if first == 0 || second < first {
+    t.Errorf("rebuilt with the time bounds %d, after %d", second, first)
+  }
+  for _, p := range pairs {
+    if _, ok := srv.Account(p.Address()); !ok {
+      t.Errorf("%s was not created", p.Address())
+    }
+  }
+}
+
+func TestLandedNotResubmitted(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.TxTimeout = time.Minute
+  cfg.Report = NewReport()
+  // The transaction lands, but the answer says it expired
+  client := &rejectingHorizon{Horizon: cfg.Horizon, code: "tx_too_late", forward: true, left: 1}
+  s := cfg.submitter(client, PHASE_FUND)
+  pairs, err := Generate(2)
+  if err != nil { t.Fatal(err) }
+  creator := testFunder(cfg, pairs)
+
+  funded, res, failed := s.createAndSubmit(&creator, 0, pairs)
+  if res == nil || len(funded) != 2 {
+    t.Fatalf("funded %d accounts of a transaction that landed (%v)", len(funded), failed)
+  }
+  if len(client.submitted) != 1 {
+    t.Errorf("submitted %d transactions, expected only the one that landed", len(client.submitted))
+  }
+  checkCodes(t, cfg.Report, "")
+  if hash, _ := s.hash(client.submitted[0]); cfg.Report.Transactions[0].Hash != hash {
+    t.Errorf("reported %s, expected the hash of the transaction that landed", cfg.Report.Transactions[0].Hash)
+  }
+  // Nothing was sent after it
+  var env xdr.TransactionEnvelope
+  err = xdr.SafeUnmarshalBase64(client.submitted[0], &env)
+  if err != nil { t.Fatal(err) }
+  if a, _ := srv.Account(funder.Address()); a.Sequence != int64(env.Tx.SeqNum) {
+    t.Errorf("the funder is at sequence %d, expected %d", a.Sequence, env.Tx.SeqNum)
+  }
+}
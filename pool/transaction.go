@@ -0,0 +1,242 @@
+package pool
+
+import (
+  "log"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/build"
+  "github.com/stellar/go/amount"
+  "github.com/stellar/go/keypair"
+)
+
+type TransactionCreator interface {
+  // Builds a transaction with sequence seq and returns the base64 encoded XDR
+  CreateTransaction(seq uint64, opts TxOptions, dest []*keypair.Full) (string, bool)
+  // Address of the transaction source, whose sequence number is used
+  Source(dest []*keypair.Full) string
+}
+// Settings of one transaction, picked when it is submitted
+type TxOptions struct {
+  // Fee of each operation, in stroops (0 for the network's default)
+  BaseFee uint64
+  // Unix time when the transaction expires (0 for never)
+  MaxTime uint64
+  // Index of the batch of operations in its phase, for the memo
+  Batch int
+}
+
+type AccountFunder struct {
+  // Initial balance of each account, in stroops, by address
+  Amounts map[string]int64
+  Pub string
+  Sec string
+  // Sign for the funder instead of Sec, like the keys of a multisig funder (optional)
+  Signers []Signer
+  Seq uint64
+  Network build.Network
+  Memo Memo
+  // Transaction source that pays the fee, if not the funder (optional)
+  Channel *keypair.Full
+  // Also set this inflation destination, each new account signing its
+  // own setOptions operation in the same transaction (optional)
+  InfDest string
+}
+type InflationSetter struct {
+  C Horizon
+  InfDest string
+  Network build.Network
+  Memo Memo
+  // Transaction source that pays the fee, instead of the first pair (optional)
+  FeeSource string
+  FeeSigners []Signer
+}
+
+// Merges the accounts into Dest, returning their balance
+type AccountMerger struct {
+  Dest string
+  Network build.Network
+  Memo Memo
+}
+
+func (m AccountFunder) CreateTransaction(seq uint64, opts TxOptions, dest []*keypair.Full) (string, bool) {
+  // Create a mutator for each createAccount operation (and setOptions)
+  var muts []build.TransactionMutator
+  for _, p := range dest {
+    // Initial balance picked by the distribution, in exact stroops
+    a, ok := m.Amounts[p.Address()]
+    if !ok {
+      log.Println("Error creating transaction: no amount for", p.Address())
+      return "", true
+    }
+
+    // Add the operation to the slice (the funder is its source, even in channels)
+    muts = append(muts, build.CreateAccount(
+      build.SourceAccount{ m.Pub },
+      build.Destination{ p.Address() },
+      build.NativeAmount{ amount.String(xdr.Int64(a)) },
+    ))
+    // The account exists by the next operation, which it is the source of
+    if m.InfDest != "" {
+      muts = append(muts, build.SetOptions(
+        build.SourceAccount{ p.Address() },
+        build.InflationDest(m.InfDest),
+      ))
+    }
+  }
+
+  signers := m.Signers
+  if len(signers) == 0 {
+    signer, err := SeedSigner(m.Sec)
+    if logErr(err, "Error parsing the funder secret:") { return "", true }
+    signers = []Signer{signer}
+  }
+  // With a channel, it is the transaction source and also signs it
+  src := m.Pub
+  if m.Channel != nil {
+    src = m.Channel.Address()
+    signers = append(signers, KeypairSigner{m.Channel})
+  }
+  if m.InfDest != "" {
+    signers = append(append([]Signer{}, signers...), pairSigners(dest)...)
+  }
+
+  memo, err := m.Memo.mutator(FUND_MEMO, opts.Batch, m.Pub)
+  if logErr(err, "Error creating the memo:") { return "", true }
+
+  // Create the transaction with these mutators and get the XDR
+  tx, notOk := createTx(m.Network, src, seq, memo, opts, signers, muts...)
+  if notOk {
+    return "", true
+  } else {
+    return tx, false
+  }
+}
+
+func (m AccountFunder) Source(dest []*keypair.Full) string {
+  if m.Channel != nil {
+    return m.Channel.Address()
+  }
+  return m.Pub
+}
+
+func (m InflationSetter) Source(dest []*keypair.Full) string {
+  if m.FeeSource != "" { return m.FeeSource }
+  if len(dest) <= 0 { return "" }
+  return dest[0].Address()
+}
+
+func (m InflationSetter) CreateTransaction(seq uint64, opts TxOptions, dest []*keypair.Full) (string, bool) {
+  // There must be at least one keypair to create the transaction
+  if len(dest) <= 0 { return "", true }
+
+  // Get the sequence number of the source, if it wasn't received
+  pub := m.Source(dest)
+  if seq == 0 {
+    var err error
+    seq, err = getSequence(m.C, pub)
+    if logErr(err, "Error getting sequence from Horizon:") {return "", true}
+    log.Println(pub, "sequence:", seq)
+  }
+
+  // Create a mutator for each setOptions operation
+  muts := make([]build.TransactionMutator, len(dest))
+  for i, p := range dest {
+    muts[i] = build.SetOptions(
+      build.SourceAccount{ p.Address() },
+      build.InflationDest(m.InfDest),
+    )
+  }
+  // Every pair signs its own operation, and the fee source the transaction
+  signers := append(append([]Signer{}, m.FeeSigners...), pairSigners(dest)...)
+
+  memo, err := m.Memo.mutator(INFLATION_MEMO, opts.Batch, m.InfDest)
+  if logErr(err, "Error creating the memo:") { return "", true }
+
+  // Create the transaction with these mutators and get the XDR
+  tx, notOk := createTx(m.Network, pub, seq, memo, opts, signers, muts...)
+  if notOk {
+    return "", true
+  } else {
+    return tx, false
+  }
+}
+
+func (m AccountMerger) Source(dest []*keypair.Full) string {
+  if len(dest) <= 0 { return "" }
+  return dest[0].Address()
+}
+
+func (m AccountMerger) CreateTransaction(seq uint64, opts TxOptions, dest []*keypair.Full) (string, bool) {
+  // There must be at least one keypair to create the transaction
+  if len(dest) <= 0 { return "", true }
+
+  // Create a mutator for each accountMerge operation, merging the pair into m.Dest
+  muts := make([]build.TransactionMutator, len(dest))
+  for i, p := range dest {
+    muts[i] = build.AccountMerge(
+      build.SourceAccount{ p.Address() },
+      build.Destination{ m.Dest },
+    )
+  }
+  signers := pairSigners(dest)
+
+  memo, err := m.Memo.mutator(MERGE_MEMO, opts.Batch, m.Dest)
+  if logErr(err, "Error creating the memo:") { return "", true }
+
+  // The first pair is the transaction source, merged after paying the fee
+  tx, notOk := createTx(m.Network, dest[0].Address(), seq, memo, opts, signers, muts...)
+  if notOk {
+    return "", true
+  } else {
+    return tx, false
+  }
+}
+
+// General function to create transactions, checking each step along the way
+func createTx(network build.Network, src string, seq uint64, memo build.TransactionMutator, opts TxOptions, signers []Signer, muts ...build.TransactionMutator) (string, bool) {
+  // Create the base transaction
+  tx, err := build.Transaction(
+    build.SourceAccount{ src },
+    build.Sequence{ seq },
+    memo,
+    network,
+  )
+  if logErr(err, "Error building base transaction:") {return "", true}
+
+  // Set the operations (received as a slice of TransactionMutators)
+  err = tx.Mutate(muts...)
+  if logErr(err, "Error mutating transaction:") {return "", true}
+
+  // Pay more than the network's default fee, if asked to
+  if opts.BaseFee > 0 {
+    err = tx.Mutate(build.BaseFee{ opts.BaseFee })
+    if logErr(err, "Error setting the fee:") {return "", true}
+  }
+
+  // Stop it from landing long after it was built, like after a 504
+  if opts.MaxTime > 0 {
+    err = tx.Mutate(build.Timebounds{ MaxTime: opts.MaxTime })
+    if logErr(err, "Error setting the time bounds:") {return "", true}
+  }
+
+  // Run the default mutations, such as calculating the Fee
+  err = tx.Mutate(build.Defaults{})
+  if logErr(err, "Error applying default mutations:") {return "", true}
+
+  // Get the envelope, and sign its hash with each signer received
+  txe, err := tx.Sign()
+  if logErr(err, "Error creating the Tx envelope:") {return "", true}
+  hash, err := tx.Hash()
+  if logErr(err, "Error hashing the transaction:") {return "", true}
+  for _, s := range signers {
+    sig, err := s.Sign(hash)
+    if logErr(err, "Error signing the transaction with " + s.Address() + ":") {return "", true}
+    txe.E.Signatures = append(txe.E.Signatures, sig)
+  }
+
+  // Get the XDR in Base64 from the Transaction Envelope
+  txb64, err := txe.Base64()
+  if logErr(err, "Error getting XDR from the Tx envelope:") {return "", true}
+
+  // The transaction is finally done!
+  return txb64, false
+}
@@ -0,0 +1,134 @@
+package pool
+
+import (
+  "log"
+  "math"
+  "sync"
+  "errors"
+  "regexp"
+  "context"
+  "runtime"
+  "strings"
+  "sync/atomic"
+  "github.com/stellar/go/keypair"
+)
+
+// Characters of the base32 alphabet used in addresses
+const ADDRESS_ALPHABET = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+// Vanity describes the addresses searched for, any of the fields can be empty
+type Vanity struct {
+  // Start of the address, including the leading G
+  Prefix string
+  // End of the address
+  Suffix string
+  // Regular expression the address must match
+  Regexp *regexp.Regexp
+}
+
+// Enabled is true if the addresses have to match something
+func (v Vanity) Enabled() bool {
+  return v.Prefix != "" || v.Suffix != "" || v.Regexp != nil
+}
+
+// Checks that addresses matching the prefix and suffix can exist
+func (v Vanity) validate() error {
+  for _, c := range v.Prefix + v.Suffix {
+    if !strings.ContainsRune(ADDRESS_ALPHABET, c) {
+      return errors.New("vanity prefix and suffix can only have the characters " + ADDRESS_ALPHABET)
+    }
+  }
+  if len(v.Prefix) + len(v.Suffix) > 56 {
+    return errors.New("vanity prefix and suffix are longer than an address")
+  }
+  if v.Prefix != "" && v.Prefix[0] != 'G' {
+    return errors.New("addresses always start with G")
+  }
+  // The second character only has the 2 first bits of the key
+  if len(v.Prefix) > 1 && !strings.ContainsRune("ABCD", rune(v.Prefix[1])) {
+    return errors.New("the second character of an address is always A, B, C or D")
+  }
+  return nil
+}
+
+// ExpectedAttempts is the average number of keypairs generated for each
+// address that matches the prefix and suffix (0 if unknown, with a Regexp)
+func (v Vanity) ExpectedAttempts() float64 {
+  if v.Regexp != nil { return 0 }
+  free := len(v.Prefix) + len(v.Suffix)
+  attempts := 1.0
+  // The G is fixed, and the second character only has 4 possible values
+  if len(v.Prefix) > 0 { free-- }
+  if len(v.Prefix) > 1 {
+    free--
+    attempts = 4
+  }
+  return attempts * math.Pow(32, float64(free))
+}
+
+// Matches is true if address matches every field of v
+func (v Vanity) Matches(address string) bool {
+  return strings.HasPrefix(address, v.Prefix) &&
+    strings.HasSuffix(address, v.Suffix) &&
+    (v.Regexp == nil || v.Regexp.MatchString(address))
+}
+
+// GenerateVanity creates num random keypairs whose address matches v,
+// searching with one goroutine per CPU core
+func GenerateVanity(ctx context.Context, v Vanity, num int) (Voters, error) {
+  err := v.validate()
+  if err != nil { return nil, err }
+  if num <= 0 { return Voters{}, nil }
+  workers := runtime.NumCPU()
+  if expected := v.ExpectedAttempts(); expected > 0 {
+    log.Printf("Searching %d vanity addresses with %d workers, %.0f attempts expected for each",
+      num, workers, expected)
+  } else {
+    log.Println("Searching", num, "vanity addresses with", workers, "workers")
+  }
+
+  var wg sync.WaitGroup
+  var attempts uint64
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel()
+  found := make(chan *keypair.Full, workers)
+  errs := make(chan error, workers)
+  for w := 0; w < workers; w++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for ctx.Err() == nil {
+        p, err := keypair.Random()
+        if err != nil {
+          errs<- err
+          return
+        }
+        atomic.AddUint64(&attempts, 1)
+        if !v.Matches(p.Address()) { continue }
+        select {
+        case found<- p:
+        case <-ctx.Done():
+        }
+      }
+    }()
+  }
+
+  pairs := make(Voters, 0, num)
+  for len(pairs) < num && err == nil {
+    select {
+    case p := <-found:
+      pairs = append(pairs, p)
+      log.Println("Found", p.Address(), "(", len(pairs), "of", num, "after",
+        atomic.LoadUint64(&attempts), "attempts )")
+    case err = <-errs:
+      logErr(err, "Error creating random keypair:")
+    case <-ctx.Done():
+      err = ctx.Err()
+    }
+  }
+  // Stop the workers, the extra keypairs they found are discarded
+  cancel()
+  wg.Wait()
+  if err != nil { return nil, err }
+  return pairs, nil
+}
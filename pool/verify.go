@@ -0,0 +1,105 @@
+package pool
+
+import (
+  "sync"
+  "context"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// AccountCheck compares the state of an account on the network with the
+// expected by the pool
+type AccountCheck struct {
+  Pub string `json:"pub"`
+  Exists bool `json:"exists"`
+  InflationDest string `json:"inflation_destination,omitempty"`
+  // Native balance, in XLM
+  Balance string `json:"balance,omitempty"`
+  // True if the account exists and its inflation destination is the expected
+  OK bool `json:"ok"`
+  // Error loading the account, other than it not existing
+  Error string `json:"error,omitempty"`
+}
+
+// VerifyReport has the check of every account and how many are in each case
+type VerifyReport struct {
+  InflationDest string `json:"expected_inflation_destination"`
+  Total int `json:"total"`
+  OK int `json:"ok"`
+  Missing int `json:"missing"`
+  WrongInflation int `json:"wrong_inflation_destination"`
+  Errors int `json:"errors"`
+  Accounts []AccountCheck `json:"accounts"`
+}
+
+// Verify loads each account from Horizon (WG_MAX at a time) and checks that
+// its inflation destination is cfg.InflationDest. The checks are in the
+// same order as the addresses
+func Verify(ctx context.Context, cfg Config, client Horizon, addresses []string) (*VerifyReport, error) {
+  var wg sync.WaitGroup
+  err := cfg.Validate()
+  if err != nil { return nil, err }
+
+  checks := make([]AccountCheck, len(addresses))
+  guard := make(chan struct{}, WG_MAX)
+  for i, a := range addresses {
+    if ctx.Err() != nil { break }
+    // This blocks when guard is full
+    guard<- struct{}{}
+    wg.Add(1)
+    go func(i int, a string) {
+      defer wg.Done()
+      // Each goroutine writes only its own element
+      checks[i] = checkAccount(client, a, cfg.InflationDest)
+      <-guard
+    }(i, a)
+  }
+  wg.Wait()
+  if ctx.Err() != nil { return nil, ctx.Err() }
+
+  report := &VerifyReport{
+    InflationDest: cfg.InflationDest,
+    Total: len(checks),
+    Accounts: checks,
+  }
+  for _, c := range checks {
+    switch {
+    case c.OK:
+      report.OK++
+    case c.Error != "":
+      report.Errors++
+    case !c.Exists:
+      report.Missing++
+    default:
+      report.WrongInflation++
+    }
+  }
+  return report, nil
+}
+
+func checkAccount(client Horizon, address string, infDest string) AccountCheck {
+  check := AccountCheck{Pub: address}
+  acc, err := client.LoadAccount(address)
+  if err != nil {
+    // Horizon answers 404 for accounts that don't exist
+    if herr, ok := err.(*horizon.Error); !ok || herr.Problem.Status != 404 {
+      logErr(err, "Error loading account " + address + ":")
+      check.Error = err.Error()
+    }
+    return check
+  }
+  check.Exists = true
+  check.InflationDest = acc.InflationDestination
+  check.Balance = nativeBalance(acc)
+  check.OK = acc.InflationDestination == infDest
+  return check
+}
+
+// Balance of the account in XLM, "" if it has none
+func nativeBalance(acc horizon.Account) string {
+  for _, b := range acc.Balances {
+    if b.Type == "native" {
+      return b.Balance
+    }
+  }
+  return ""
+}
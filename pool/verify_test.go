@@ -0,0 +1,69 @@
+package pool
+
+import (
+  "errors"
+  "testing"
+  "context"
+  "github.com/stellar/go/clients/horizon"
+)
+
+// Fails to load the account address, like when Horizon can't be reached
+type unreachableHorizon struct {
+  Horizon
+  address string
+}
+
+func (h unreachableHorizon) LoadAccount(address string) (horizon.Account, error) {
+  if address == h.address {
+    return horizon.Account{}, errors.New("connection refused")
+  }
+  return h.Horizon.LoadAccount(address)
+}
+
+func TestVerify(t *testing.T) {
+  srv, funder, cfg, done := testRun(t)
+  defer done()
+  cfg.NumAccounts = 3
+  res, err := Run(context.Background(), cfg)
+  if err != nil { t.Fatal(err) }
+
+  // An account voting for nobody, one that doesn't exist and one that
+  // can't be loaded
+  keys, err := Generate(3)
+  if err != nil { t.Fatal(err) }
+  other, missing, unreachable := keys[0].Address(), keys[1].Address(), keys[2].Address()
+  srv.AddAccount(other, 100000000)
+  srv.AddAccount(unreachable, 100000000)
+  addresses := append(res.Generated.addresses(), other, missing, unreachable)
+
+  report, err := Verify(context.Background(), cfg, unreachableHorizon{cfg.Horizon, unreachable}, addresses)
+  if err != nil { t.Fatal(err) }
+  if report.InflationDest != funder.Address() || report.Total != 6 || report.OK != 3 ||
+    report.Missing != 1 || report.WrongInflation != 1 || report.Errors != 1 {
+    t.Errorf("reported %d of %d ok for %s, %d missing, %d wrong and %d errors", report.OK,
+      report.Total, report.InflationDest, report.Missing, report.WrongInflation, report.Errors)
+  }
+  // In the same order as the addresses
+  for i, c := range report.Accounts {
+    if c.Pub != addresses[i] {
+      t.Fatalf("check %d is of %s, expected %s", i, c.Pub, addresses[i])
+    }
+  }
+  if c := report.Accounts[3]; !c.Exists || c.OK || c.InflationDest != "" || c.Balance != "10.0000000" {
+    t.Errorf("checked the account voting for nobody as %+v", c)
+  }
+  if c := report.Accounts[4]; c.Exists || c.OK || c.Error != "" {
+    t.Errorf("checked the missing account as %+v", c)
+  }
+  if c := report.Accounts[5]; c.OK || c.Error == "" {
+    t.Errorf("checked the account that can't be loaded as %+v", c)
+  }
+
+  // Any other destination fails every account
+  cfg.InflationDest = other
+  report, err = Verify(context.Background(), cfg, cfg.Horizon, res.Generated.addresses())
+  if err != nil { t.Fatal(err) }
+  if report.OK != 0 || report.WrongInflation != cfg.NumAccounts {
+    t.Errorf("%d accounts voting for %s, expected none", report.OK, other)
+  }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+  "os"
+  "log"
+  "flag"
+  "errors"
+  "strconv"
+  "github.com/BurntSushi/toml"
+)
+
+// Default config file, only read if it exists
+const CONFIG_FILE = "stellar-pool.toml"
+
+// Settings of a network, all optional. Flags given in the command line
+// take precedence over them
+type profile struct {
+  Horizon string `toml:"horizon"`
+  NetworkPassphrase string `toml:"network_passphrase"`
+  Friendbot string `toml:"friendbot"`
+  Live bool `toml:"live"`
+  Funder string `toml:"funder"`
+  Inflation string `toml:"inflation"`
+  Ops int `toml:"ops"`
+  Channels int `toml:"channels"`
+}
+
+// Config file with named profiles, and the one used by default
+type configFile struct {
+  Profile string `toml:"profile"`
+  Profiles map[string]profile `toml:"profiles"`
+}
+
+// Values of the flags set by the profile
+func (p profile) flags() map[string]string {
+  values := make(map[string]string)
+  set := func(name string, value string) {
+    if value != "" { values[name] = value }
+  }
+  set("horizon", p.Horizon)
+  set("network", p.NetworkPassphrase)
+  set("friendbot", p.Friendbot)
+  if p.Live { values["live"] = "true" }
+  set("src", p.Funder)
+  set("inflation", p.Inflation)
+  if p.Ops > 0 { values["ops"] = strconv.Itoa(p.Ops) }
+  if p.Channels > 0 { values["channels"] = strconv.Itoa(p.Channels) }
+  return values
+}
+
+// Reads the profile from the config file and uses its values for the flags
+// that weren't given in the command line
+func applyProfile(name string, profileName string) error {
+  set := make(map[string]bool)
+  flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+  if _, err := os.Stat(name); os.IsNotExist(err) && !set["config"] {
+    if profileName != "" {
+      return errors.New("no config file for the profile " + profileName)
+    }
+    return nil
+  }
+  var file configFile
+  md, err := toml.DecodeFile(name, &file)
+  if err != nil { return err }
+  for _, k := range md.Undecoded() {
+    log.Println("Unknown setting in", name + ":", k.String())
+  }
+
+  if profileName == "" {
+    profileName = file.Profile
+  }
+  if profileName == "" { return nil }
+  p, ok := file.Profiles[profileName]
+  if !ok {
+    return errors.New("no profile " + profileName + " in " + name)
+  }
+  log.Println("Using the profile", profileName, "of", name)
+  for flagName, value := range p.flags() {
+    if set[flagName] { continue }
+    err = flag.Set(flagName, value)
+    if err != nil { return err }
+  }
+  return nil
+}
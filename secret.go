@@ -0,0 +1,120 @@
+package main
+
+import (
+  "os"
+  "fmt"
+  "flag"
+  "errors"
+  "strings"
+  "io/ioutil"
+  "golang.org/x/crypto/ssh/terminal"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
+)
+
+// Environment variable with the funder's secret seed
+const SECRET_ENV = "STELLAR_POOL_SECRET"
+// Environment variable with the secret seed of -feePayer
+const FEE_PAYER_SECRET_ENV = "STELLAR_POOL_FEE_PAYER_SECRET"
+
+// Reads the funder's secret seed from the -sec flag, the -secFile file, the
+// environment or the terminal. Only one of them can be used, and the flag
+// (which ends up in the shell history) needs -insecureSec on livenet
+func readSecret() (string, error) {
+  given := false
+  flag.Visit(func(f *flag.Flag) { given = given || f.Name == "sec" })
+  env := os.Getenv(SECRET_ENV)
+
+  sources := 0
+  for _, ok := range []bool{given, secretFile != "", env != "", askSecret} {
+    if ok { sources++ }
+  }
+  if sources > 1 {
+    return "", errors.New("give the funder secret in only one way " +
+      "(-sec, -secFile, " + SECRET_ENV + " or -askSec)")
+  }
+
+  switch {
+  case given:
+    if cfg.Livenet && !insecureSecret {
+      return "", errors.New("-sec is saved in the shell history, use -secFile, " +
+        SECRET_ENV + " or -askSec on livenet (or -insecureSec)")
+    }
+    return cfg.FunderSec, nil
+  case secretFile != "":
+    return readSecretFile(secretFile)
+  case env != "":
+    return env, nil
+  case askSecret:
+    fmt.Fprint(os.Stderr, "Funder secret seed: ")
+    sec, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+    fmt.Fprintln(os.Stderr)
+    if err != nil { return "", err }
+    return strings.TrimSpace(string(sec)), nil
+  }
+  return "", nil
+}
+
+// Reads the secret seed of -feePayer from -feePayerSecFile or the
+// environment, unless the funder pays the fees
+func readFeePayerSecret() (string, error) {
+  if cfg.FeePayer == "" || cfg.FeePayer == cfg.FunderPub { return "", nil }
+  env := os.Getenv(FEE_PAYER_SECRET_ENV)
+  if feePayerSecFile != "" && env != "" {
+    return "", errors.New("give the fee payer secret in only one way " +
+      "(-feePayerSecFile or " + FEE_PAYER_SECRET_ENV + ")")
+  }
+  if feePayerSecFile != "" {
+    return readSecretFile(feePayerSecFile)
+  }
+  return env, nil
+}
+
+// Flag that can be repeated, keeping every value
+type listFlag []string
+
+func (l *listFlag) String() string {
+  return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+  *l = append(*l, value)
+  return nil
+}
+
+// Signers of the funder from -signer, -cosigner and -cosignerFile
+func readCosigners() ([]pool.Signer, error) {
+  var signers []pool.Signer
+  token := os.Getenv(SIGNER_TOKEN_ENV)
+  for _, c := range cosigners {
+    parts := strings.SplitN(c, "=", 2)
+    if len(parts) != 2 {
+      return nil, errors.New("invalid -cosigner " + c + ", expected <address>=<URL>")
+    }
+    signers = append(signers, &pool.RemoteSigner{URL: parts[1], Pub: parts[0], Token: token})
+  }
+  for _, name := range cosignerFiles {
+    sec, err := readSecretFile(name)
+    if err != nil { return nil, err }
+    s, err := pool.SeedSigner(sec)
+    if err != nil { return nil, errors.New("invalid secret seed in " + name) }
+    signers = append(signers, s)
+  }
+  return signers, nil
+}
+
+// Reads the secret seed from the file, which must not be accessible by
+// other users
+func readSecretFile(name string) (string, error) {
+  info, err := os.Stat(name)
+  if err != nil { return "", err }
+  if !info.Mode().IsRegular() {
+    return "", errors.New(name + " is not a regular file")
+  }
+  if info.Mode().Perm() & 0077 != 0 {
+    return "", errors.New(fmt.Sprintf("%s can be accessed by other users (mode %#o), " +
+      "make it private with: chmod 600 %s", name, info.Mode().Perm(), name))
+  }
+  data, err := ioutil.ReadFile(name)
+  if err != nil { return "", err }
+  return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,94 @@
+// Package signertest is a reference signing service for pool.RemoteSigner.
+// It signs any transaction hash it receives with one key, so it is meant for
+// testing, or as the starting point of a service with its own policies
+package signertest
+
+import (
+  "strings"
+  "net/http"
+  "encoding/hex"
+  "encoding/json"
+  "net/http/httptest"
+  "github.com/stellar/go/xdr"
+  "github.com/stellar/go/keypair"
+  "github.com/matheusb-comp/stellar-create-pool/pool"
+)
+
+// Handler answers pool.SignRequest bodies POSTed to any path
+type Handler struct {
+  KP *keypair.Full
+  // Bearer token required in the requests, if not ""
+  Token string
+}
+
+type Server struct {
+  // URL of the server, to be used in the RemoteSigner
+  URL string
+  srv *httptest.Server
+  handler *Handler
+}
+
+// NewServer starts a signing service for kp. The server must be closed with
+// Close when done
+func NewServer(kp *keypair.Full, token string) *Server {
+  s := &Server{handler: &Handler{KP: kp, Token: token}}
+  s.srv = httptest.NewServer(s.handler)
+  s.URL = s.srv.URL
+  return s
+}
+
+func (s *Server) Close() {
+  s.srv.Close()
+}
+
+// Signer returns a RemoteSigner connected to the server
+func (s *Server) Signer() *pool.RemoteSigner {
+  return &pool.RemoteSigner{
+    URL: s.URL,
+    Pub: s.handler.KP.Address(),
+    Token: s.handler.Token,
+  }
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  if r.Method != "POST" {
+    writeJSON(w, http.StatusMethodNotAllowed, pool.SignResponse{Error: "only POST is allowed"})
+    return
+  }
+  if h.Token != "" && r.Header.Get("Authorization") != "Bearer " + h.Token {
+    writeJSON(w, http.StatusUnauthorized, pool.SignResponse{Error: "invalid token"})
+    return
+  }
+  var req pool.SignRequest
+  err := json.NewDecoder(r.Body).Decode(&req)
+  if err != nil {
+    writeJSON(w, http.StatusBadRequest, pool.SignResponse{Error: "invalid request: " + err.Error()})
+    return
+  }
+  if req.Address != h.KP.Address() {
+    writeJSON(w, http.StatusNotFound, pool.SignResponse{Error: "no key for " + req.Address})
+    return
+  }
+  hash, err := hex.DecodeString(strings.TrimSpace(req.Hash))
+  if err != nil || len(hash) != 32 {
+    writeJSON(w, http.StatusBadRequest, pool.SignResponse{Error: "the hash must have 32 hex encoded bytes"})
+    return
+  }
+
+  sig, err := h.KP.SignDecorated(hash)
+  var sigb64 string
+  if err == nil {
+    sigb64, err = xdr.MarshalBase64(sig)
+  }
+  if err != nil {
+    writeJSON(w, http.StatusInternalServerError, pool.SignResponse{Error: err.Error()})
+    return
+  }
+  writeJSON(w, http.StatusOK, pool.SignResponse{Signature: sigb64})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(status)
+  json.NewEncoder(w).Encode(v)
+}